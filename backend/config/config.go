@@ -4,6 +4,8 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -11,8 +13,10 @@ import (
 type Config struct {
 	// 服务器配置
 	Server struct {
-		Port string
-		Mode string // development, production
+		Port            string
+		Mode            string        // development, production
+		ShutdownTimeout time.Duration // 优雅关闭时等待连接发送完毕的最长时间
+		InstanceID      string        // 实例ID，多实例部署时每个实例唯一且重启后不变，为空时每次启动随机生成
 	}
 
 	// 数据库配置
@@ -42,6 +46,43 @@ type Config struct {
 	CORS struct {
 		AllowOrigins []string
 	}
+
+	// 管理员配置
+	Admin struct {
+		UserIDs []string // 可以访问管理接口的用户ID
+	}
+
+	// 跨实例消息转发配置
+	Broker struct {
+		Type          string // memory, redis
+		RedisAddr     string
+		RedisPassword string
+		RedisDB       int
+		Channel       string // Redis发布订阅频道
+	}
+
+	// WebSocket配置
+	WebSocket struct {
+		PresenceGrace      time.Duration // 连接断开后标记为离线前的重连宽限期
+		SendBufferSize     int           // 每个连接的发送缓冲区大小
+		SlowConsumerPolicy string        // 发送缓冲区满时的处理策略: disconnect, drop_oldest, drop_newest, spill
+		ReadBufferSize     int           // 升级器读缓冲区大小
+		WriteBufferSize    int           // 升级器写缓冲区大小
+		MaxMessageSize     int64         // 允许客户端发送的最大消息大小
+		WriteWait          time.Duration // 写入超时
+		PongWait           time.Duration // 等待pong的超时
+		PingPeriod         time.Duration // 发送ping的间隔，必须小于PongWait
+		TicketTTL          time.Duration // 连接票据的有效期
+		EnableCompression  bool          // 是否协商permessage-deflate压缩
+		CompressionLevel   int           // 压缩级别，1最快，9压缩率最高
+	}
+
+	// 消息配置
+	Message struct {
+		EditWindow   time.Duration // 发送后允许编辑的时间
+		RecallWindow time.Duration // 发送后允许撤回的时间，群组管理员删除消息不受限制
+		MaxReactions int           // 每条消息最多的不同表情回应种类
+	}
 }
 
 // AppConfig 全局配置实例
@@ -66,6 +107,7 @@ func setDefaultConfig() {
 	// 服务器配置
 	AppConfig.Server.Port = "8080"
 	AppConfig.Server.Mode = "development"
+	AppConfig.Server.ShutdownTimeout = 15 * time.Second
 
 	// 数据库配置 - 默认使用MySQL
 	AppConfig.Database.Type = "mysql"
@@ -85,6 +127,29 @@ func setDefaultConfig() {
 
 	// CORS配置
 	AppConfig.CORS.AllowOrigins = []string{"http://localhost:3000"}
+
+	// 跨实例消息转发配置 - 默认只在本实例内投递
+	AppConfig.Broker.Type = "memory"
+	AppConfig.Broker.RedisAddr = "localhost:6379"
+	AppConfig.Broker.Channel = "gin-vue-chat:hub"
+
+	// WebSocket配置
+	AppConfig.WebSocket.PresenceGrace = 10 * time.Second
+	AppConfig.WebSocket.SendBufferSize = 256
+	AppConfig.WebSocket.SlowConsumerPolicy = "disconnect"
+	AppConfig.WebSocket.ReadBufferSize = 1024
+	AppConfig.WebSocket.WriteBufferSize = 1024
+	AppConfig.WebSocket.MaxMessageSize = 4096
+	AppConfig.WebSocket.WriteWait = 10 * time.Second
+	AppConfig.WebSocket.PongWait = 60 * time.Second
+	AppConfig.WebSocket.PingPeriod = 54 * time.Second
+	AppConfig.WebSocket.TicketTTL = 30 * time.Second
+	AppConfig.WebSocket.EnableCompression = false
+	AppConfig.WebSocket.CompressionLevel = 1
+
+	AppConfig.Message.EditWindow = 15 * time.Minute
+	AppConfig.Message.RecallWindow = 2 * time.Minute
+	AppConfig.Message.MaxReactions = 20
 }
 
 // 从环境变量加载配置
@@ -96,6 +161,14 @@ func loadFromEnv() {
 	if mode := os.Getenv("GIN_MODE"); mode != "" {
 		AppConfig.Server.Mode = mode
 	}
+	if timeout := os.Getenv("SHUTDOWN_TIMEOUT"); timeout != "" {
+		if d, err := time.ParseDuration(timeout); err == nil && d > 0 {
+			AppConfig.Server.ShutdownTimeout = d
+		}
+	}
+	if instanceID := os.Getenv("INSTANCE_ID"); instanceID != "" {
+		AppConfig.Server.InstanceID = instanceID
+	}
 
 	// 数据库配置
 	if dbType := os.Getenv("DB_TYPE"); dbType != "" {
@@ -128,10 +201,126 @@ func loadFromEnv() {
 		AppConfig.MongoDB.Database = mongoDB
 	}
 
+	// CORS配置，多个来源用逗号分隔
+	if origins := os.Getenv("CORS_ALLOW_ORIGINS"); origins != "" {
+		AppConfig.CORS.AllowOrigins = nil
+		for _, origin := range strings.Split(origins, ",") {
+			if origin = strings.TrimSpace(origin); origin != "" {
+				AppConfig.CORS.AllowOrigins = append(AppConfig.CORS.AllowOrigins, origin)
+			}
+		}
+	}
+
+	// 管理员配置，多个用户ID用逗号分隔
+	if adminIDs := os.Getenv("ADMIN_USER_IDS"); adminIDs != "" {
+		AppConfig.Admin.UserIDs = nil
+		for _, id := range strings.Split(adminIDs, ",") {
+			if id = strings.TrimSpace(id); id != "" {
+				AppConfig.Admin.UserIDs = append(AppConfig.Admin.UserIDs, id)
+			}
+		}
+	}
+
 	// JWT配置
 	if jwtSecret := os.Getenv("JWT_SECRET"); jwtSecret != "" {
 		AppConfig.JWT.Secret = jwtSecret
 	}
+
+	// 跨实例消息转发配置
+	if brokerType := os.Getenv("BROKER_TYPE"); brokerType != "" {
+		AppConfig.Broker.Type = brokerType
+	}
+	if redisAddr := os.Getenv("REDIS_ADDR"); redisAddr != "" {
+		AppConfig.Broker.RedisAddr = redisAddr
+	}
+	if redisPassword := os.Getenv("REDIS_PASSWORD"); redisPassword != "" {
+		AppConfig.Broker.RedisPassword = redisPassword
+	}
+	if redisDB := os.Getenv("REDIS_DB"); redisDB != "" {
+		if db, err := strconv.Atoi(redisDB); err == nil {
+			AppConfig.Broker.RedisDB = db
+		}
+	}
+	if channel := os.Getenv("BROKER_CHANNEL"); channel != "" {
+		AppConfig.Broker.Channel = channel
+	}
+
+	// WebSocket配置
+	if grace := os.Getenv("WS_PRESENCE_GRACE"); grace != "" {
+		if d, err := time.ParseDuration(grace); err == nil {
+			AppConfig.WebSocket.PresenceGrace = d
+		}
+	}
+	if size := os.Getenv("WS_SEND_BUFFER_SIZE"); size != "" {
+		if n, err := strconv.Atoi(size); err == nil && n > 0 {
+			AppConfig.WebSocket.SendBufferSize = n
+		}
+	}
+	if policy := os.Getenv("WS_SLOW_CONSUMER_POLICY"); policy != "" {
+		AppConfig.WebSocket.SlowConsumerPolicy = policy
+	}
+	if size := os.Getenv("WS_READ_BUFFER_SIZE"); size != "" {
+		if n, err := strconv.Atoi(size); err == nil && n > 0 {
+			AppConfig.WebSocket.ReadBufferSize = n
+		}
+	}
+	if size := os.Getenv("WS_WRITE_BUFFER_SIZE"); size != "" {
+		if n, err := strconv.Atoi(size); err == nil && n > 0 {
+			AppConfig.WebSocket.WriteBufferSize = n
+		}
+	}
+	if size := os.Getenv("WS_MAX_MESSAGE_SIZE"); size != "" {
+		if n, err := strconv.ParseInt(size, 10, 64); err == nil && n > 0 {
+			AppConfig.WebSocket.MaxMessageSize = n
+		}
+	}
+	if wait := os.Getenv("WS_WRITE_WAIT"); wait != "" {
+		if d, err := time.ParseDuration(wait); err == nil {
+			AppConfig.WebSocket.WriteWait = d
+		}
+	}
+	if wait := os.Getenv("WS_PONG_WAIT"); wait != "" {
+		if d, err := time.ParseDuration(wait); err == nil {
+			AppConfig.WebSocket.PongWait = d
+		}
+	}
+	if period := os.Getenv("WS_PING_PERIOD"); period != "" {
+		if d, err := time.ParseDuration(period); err == nil {
+			AppConfig.WebSocket.PingPeriod = d
+		}
+	}
+	if ttl := os.Getenv("WS_TICKET_TTL"); ttl != "" {
+		if d, err := time.ParseDuration(ttl); err == nil && d > 0 {
+			AppConfig.WebSocket.TicketTTL = d
+		}
+	}
+	if compression := os.Getenv("WS_ENABLE_COMPRESSION"); compression != "" {
+		if enabled, err := strconv.ParseBool(compression); err == nil {
+			AppConfig.WebSocket.EnableCompression = enabled
+		}
+	}
+	if level := os.Getenv("WS_COMPRESSION_LEVEL"); level != "" {
+		if n, err := strconv.Atoi(level); err == nil {
+			AppConfig.WebSocket.CompressionLevel = n
+		}
+	}
+
+	// 消息配置
+	if window := os.Getenv("MESSAGE_EDIT_WINDOW"); window != "" {
+		if d, err := time.ParseDuration(window); err == nil {
+			AppConfig.Message.EditWindow = d
+		}
+	}
+	if window := os.Getenv("MESSAGE_RECALL_WINDOW"); window != "" {
+		if d, err := time.ParseDuration(window); err == nil {
+			AppConfig.Message.RecallWindow = d
+		}
+	}
+	if limit := os.Getenv("MESSAGE_MAX_REACTIONS"); limit != "" {
+		if n, err := strconv.Atoi(limit); err == nil {
+			AppConfig.Message.MaxReactions = n
+		}
+	}
 }
 
 // 确保数据目录存在
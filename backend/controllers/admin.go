@@ -0,0 +1,55 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yourusername/gin-vue-chat/websocket"
+)
+
+// ListHubClients 列出本实例的WebSocket、SSE和长轮询连接，可按userId过滤
+func ListHubClients(c *gin.Context) {
+	hub := c.MustGet("wsHub").(*websocket.Hub)
+	clients := hub.Clients(c.Query("userId"))
+
+	c.JSON(http.StatusOK, gin.H{
+		"instance": hub.ID(),
+		"clients":  clients,
+		"stats":    hub.Stats(),
+	})
+}
+
+// GetHubStats 获取本实例的连接数和慢消费者统计，包括各丢帧策略丢弃的帧数，
+// 便于排查消息延迟的用户
+func GetHubStats(c *gin.Context) {
+	hub := c.MustGet("wsHub").(*websocket.Hub)
+
+	c.JSON(http.StatusOK, gin.H{
+		"instance": hub.ID(),
+		"stats":    hub.Stats(),
+	})
+}
+
+// DisconnectHubClient 强制断开指定连接
+func DisconnectHubClient(c *gin.Context) {
+	hub := c.MustGet("wsHub").(*websocket.Hub)
+
+	// 连接可能在其他实例上，断开请求会转发给所有实例
+	found := hub.DisconnectClient(c.Param("clientId"))
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "已发送断开请求",
+		"local":   found,
+	})
+}
+
+// DisconnectUserClients 强制断开用户的所有连接，例如修改密码后
+func DisconnectUserClients(c *gin.Context) {
+	hub := c.MustGet("wsHub").(*websocket.Hub)
+	count := hub.DisconnectUser(c.Param("userId"))
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "已发送断开请求",
+		"local":   count,
+	})
+}
@@ -73,13 +73,7 @@ func Login(c *gin.Context) {
 		return
 	}
 
-	// 更新用户状态为在线
-	user.Status = "online"
-	err = models.UpdateUser(user)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新用户状态失败"})
-		return
-	}
+	// 在线状态由WebSocket连接的建立和断开维护，登录时不再修改
 
 	// 生成JWT令牌
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
@@ -0,0 +1,474 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yourusername/gin-vue-chat/models"
+	"github.com/yourusername/gin-vue-chat/websocket"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// 通话事件类型，信令是即时的，不进入待确认存储
+const (
+	callEventType   = "call"        // 通话状态变化
+	callSignalEvent = "call_signal" // 转发的SDP和ICE候选
+)
+
+// 呼叫无人接听时自动结束的时间
+const callRingTimeout = 45 * time.Second
+
+// StartCallRequest 发起通话请求
+type StartCallRequest struct {
+	Type     string `json:"type" binding:"required,oneof=private group"`
+	TargetID string `json:"targetId" binding:"required"` // 私聊为对方用户ID，群聊为群组ID
+	Media    string `json:"media" binding:"required,oneof=audio video"`
+}
+
+// CallActionRequest 接听、拒绝或挂断通话请求
+type CallActionRequest struct {
+	CallID string `json:"callId" binding:"required"`
+}
+
+// CallSignalRequest 转发WebRTC信令请求，data原样转发给对方
+type CallSignalRequest struct {
+	CallID string          `json:"callId"`
+	To     string          `json:"to" binding:"required"`
+	Kind   string          `json:"kind" binding:"required,oneof=offer answer ice"`
+	Data   json.RawMessage `json:"data" binding:"required"`
+}
+
+// callRecipients 通话的所有相关用户，排除actorID
+func callRecipients(call *models.Call, actorID string) []string {
+	recipients := make([]string, 0, len(call.Invitees)+1)
+	for _, id := range append([]string{call.CallerID}, call.Invitees...) {
+		if id != actorID {
+			recipients = append(recipients, id)
+		}
+	}
+	return recipients
+}
+
+// notifyCall 通知相关用户通话状态变化
+func notifyCall(hub *websocket.Hub, call *models.Call, state, actorID string, recipients []string) {
+	payload := map[string]interface{}{
+		"call":   call,
+		"state":  state,
+		"userId": actorID,
+	}
+	if state == models.CallStatusRinging {
+		payload["caller"] = senderInfo(call.CallerID)
+	}
+
+	for _, id := range recipients {
+		hub.Notify(id, callEventType, payload)
+	}
+}
+
+// callRecordContent 通话记录消息的文本内容
+func callRecordContent(call *models.Call) string {
+	media := "语音通话"
+	if call.Media == models.CallMediaVideo {
+		media = "视频通话"
+	}
+
+	switch call.Status {
+	case models.CallStatusRejected:
+		return media + " 已拒绝"
+	case models.CallStatusMissed:
+		return media + " 未接听"
+	default:
+		seconds := int(call.Duration().Seconds())
+		return fmt.Sprintf("%s 通话时长 %02d:%02d", media, seconds/60, seconds%60)
+	}
+}
+
+// loadCall 获取通话并检查用户是否被呼叫。超过呼叫超时仍未接听的通话先记为未接，
+// 例如超时计时器因实例重启而丢失
+func loadCall(hub *websocket.Hub, userID, callID string) (*models.Call, error) {
+	call, err := models.GetCallByID(callID)
+	if err != nil {
+		return nil, newServiceError(http.StatusNotFound, "通话不存在")
+	}
+	if !call.IsInvitee(userID) {
+		return nil, newServiceError(http.StatusForbidden, "您不在该通话中")
+	}
+
+	if call.Status == models.CallStatusRinging && time.Since(call.CreatedAt) > callRingTimeout {
+		if _, err := finishCall(hub, call.ID, []string{models.CallStatusRinging}, models.CallStatusMissed, call.CallerID); err != nil && !errors.Is(err, models.ErrCallStateConflict) {
+			return nil, newServiceError(http.StatusInternalServerError, "更新通话失败")
+		}
+		// 无论由谁结束，重新读取最新状态
+		if call, err = models.GetCallByID(callID); err != nil {
+			return nil, newServiceError(http.StatusNotFound, "通话不存在")
+		}
+	}
+	return call, nil
+}
+
+// scheduleRingTimeout 呼叫无人接听时记为未接，通话已被接听或结束时更新不会生效
+func scheduleRingTimeout(hub *websocket.Hub, call *models.Call) {
+	time.AfterFunc(callRingTimeout-time.Since(call.CreatedAt), func() {
+		finishCall(hub, call.ID, []string{models.CallStatusRinging}, models.CallStatusMissed, call.CallerID)
+	})
+}
+
+// ResumeCallTimeouts 重新安排启动前仍在呼叫中的通话的超时，已经超时的立即记为未接
+func ResumeCallTimeouts(hub *websocket.Hub) {
+	calls, err := models.GetRingingCalls()
+	if err != nil {
+		log.Printf("获取呼叫中的通话失败: %v", err)
+		return
+	}
+	for _, call := range calls {
+		scheduleRingTimeout(hub, call)
+	}
+}
+
+// checkCallAccess 检查用户当前是否仍有权参与通话，与消息接口的检查一致
+func checkCallAccess(call *models.Call, userID string) error {
+	if call.Type == models.MessageTypeGroup {
+		return checkGroupMembership(userID, call.GroupID)
+	}
+
+	peerID := call.ReceiverID
+	if userID == call.ReceiverID {
+		peerID = call.CallerID
+	}
+	return checkFriendship(userID, peerID)
+}
+
+// callStateError 将并发状态冲突转换为业务错误
+func callStateError(err error) error {
+	if errors.Is(err, models.ErrCallStateConflict) {
+		return newServiceError(http.StatusConflict, "通话已结束")
+	}
+	return newServiceError(http.StatusInternalServerError, "更新通话失败")
+}
+
+// startCall 校验并创建通话，然后向被呼叫方推送来电
+func startCall(hub *websocket.Hub, callerID string, req *StartCallRequest) (*models.Call, error) {
+	var receiverID, groupID string
+	var invitees []string
+
+	if req.Type == models.MessageTypePrivate {
+		if req.TargetID == callerID {
+			return nil, newServiceError(http.StatusBadRequest, "不能呼叫自己")
+		}
+		if _, err := models.GetUserByID(req.TargetID); err != nil {
+			return nil, newServiceError(http.StatusNotFound, "接收者不存在")
+		}
+		if err := checkFriendship(callerID, req.TargetID); err != nil {
+			return nil, err
+		}
+		receiverID = req.TargetID
+		invitees = []string{req.TargetID}
+	} else {
+		if err := checkGroupMembership(callerID, req.TargetID); err != nil {
+			return nil, err
+		}
+		members, err := models.GetGroupMembers(req.TargetID)
+		if err != nil {
+			return nil, newServiceError(http.StatusInternalServerError, "获取群组成员失败")
+		}
+		for _, member := range members {
+			if member.UserID != callerID {
+				invitees = append(invitees, member.UserID)
+			}
+		}
+		if len(invitees) == 0 {
+			return nil, newServiceError(http.StatusBadRequest, "群组中没有其他成员")
+		}
+		groupID = req.TargetID
+	}
+
+	call, err := models.CreateCall(req.Type, callerID, receiverID, groupID, req.Media, invitees)
+	if err != nil {
+		return nil, newServiceError(http.StatusInternalServerError, "创建通话失败")
+	}
+
+	notifyCall(hub, call, models.CallStatusRinging, callerID, invitees)
+
+	scheduleRingTimeout(hub, call)
+
+	return call, nil
+}
+
+// acceptCall 接听通话，群组通话接通后其他成员仍可加入
+func acceptCall(hub *websocket.Hub, userID, callID string) (*models.Call, error) {
+	call, err := loadCall(hub, userID, callID)
+	if err != nil {
+		return nil, err
+	}
+	if call.CallerID == userID {
+		return nil, newServiceError(http.StatusBadRequest, "不能接听自己发起的通话")
+	}
+	if err := checkCallAccess(call, userID); err != nil {
+		return nil, err
+	}
+
+	call, err = models.AcceptCall(call.ID, userID)
+	if err != nil {
+		return nil, callStateError(err)
+	}
+
+	notifyCall(hub, call, models.CallStatusAccepted, userID, callRecipients(call, userID))
+	return call, nil
+}
+
+// rejectCall 拒绝来电。私聊通话直接结束，群组通话只通知其他人该成员不加入
+func rejectCall(hub *websocket.Hub, userID, callID string) (*models.Call, error) {
+	call, err := loadCall(hub, userID, callID)
+	if err != nil {
+		return nil, err
+	}
+	if call.CallerID == userID {
+		return nil, newServiceError(http.StatusBadRequest, "呼叫方请使用挂断")
+	}
+	if err := checkCallAccess(call, userID); err != nil {
+		return nil, err
+	}
+	if call.Status != models.CallStatusRinging && !(call.Type == models.MessageTypeGroup && call.Status == models.CallStatusAccepted) {
+		return nil, newServiceError(http.StatusConflict, "通话已结束")
+	}
+
+	if call.Type == models.MessageTypePrivate {
+		call, err = finishCall(hub, call.ID, []string{models.CallStatusRinging}, models.CallStatusRejected, userID)
+		if err != nil {
+			return nil, callStateError(err)
+		}
+		return call, nil
+	}
+
+	notifyCall(hub, call, models.CallStatusRejected, userID, callRecipients(call, userID))
+	return call, nil
+}
+
+// endCall 挂断通话。呼叫中由呼叫方挂断记为未接；接通后私聊通话直接结束，
+// 群组通话在只剩一个参与者时结束
+func endCall(hub *websocket.Hub, userID, callID string) (*models.Call, error) {
+	call, err := loadCall(hub, userID, callID)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case call.Status == models.CallStatusRinging && call.CallerID == userID:
+		call, err = finishCall(hub, call.ID, []string{models.CallStatusRinging}, models.CallStatusMissed, userID)
+
+	case call.Status == models.CallStatusRinging:
+		return rejectCall(hub, userID, callID)
+
+	case call.Status == models.CallStatusAccepted && !call.IsParticipant(userID):
+		return rejectCall(hub, userID, callID)
+
+	case call.Status == models.CallStatusAccepted && call.Type == models.MessageTypePrivate:
+		call, err = finishCall(hub, call.ID, []string{models.CallStatusAccepted}, models.CallStatusEnded, userID)
+
+	case call.Status == models.CallStatusAccepted:
+		call, err = models.LeaveCall(call.ID, userID)
+		if err == nil {
+			if len(call.Participants) <= 1 {
+				call, err = finishCall(hub, call.ID, []string{models.CallStatusAccepted}, models.CallStatusEnded, userID)
+			} else {
+				notifyCall(hub, call, "left", userID, callRecipients(call, userID))
+			}
+		}
+
+	default:
+		return nil, newServiceError(http.StatusConflict, "通话已结束")
+	}
+
+	if err != nil {
+		return nil, callStateError(err)
+	}
+	return call, nil
+}
+
+// finishCall 结束通话，保存通话记录消息并通知所有相关用户
+func finishCall(hub *websocket.Hub, id primitive.ObjectID, from []string, status, actorID string) (*models.Call, error) {
+	call, err := models.FinishCall(id, from, status)
+	if err != nil {
+		if !errors.Is(err, models.ErrCallStateConflict) {
+			log.Printf("结束通话失败 (%s): %v", id.Hex(), err)
+		}
+		return nil, err
+	}
+
+	notifyCall(hub, call, status, actorID, callRecipients(call, actorID))
+
+	// 通话记录作为消息出现在会话中，双方都需要收到
+	message, err := models.SaveCallMessage(call, callRecordContent(call))
+	if err != nil {
+		log.Printf("保存通话记录失败 (%s): %v", id.Hex(), err)
+		return call, nil
+	}
+
+	if call.Type == models.MessageTypePrivate {
+		for _, userID := range []string{call.CallerID, call.ReceiverID} {
+			if err := hub.Deliver(userID, models.MessageTypePrivate, privateMessageEvent(message)); err != nil {
+				log.Printf("通话记录推送失败: %v", err)
+			}
+		}
+	} else if err := sendToGroupMessagesRoom(hub, message, ""); err != nil {
+		log.Printf("通话记录推送失败: %v", err)
+	}
+
+	return call, nil
+}
+
+// relayCallSignal 在通话双方之间转发SDP和ICE候选
+func relayCallSignal(hub *websocket.Hub, userID string, req *CallSignalRequest) error {
+	call, err := loadCall(hub, userID, req.CallID)
+	if err != nil {
+		return err
+	}
+	if call.Finished() {
+		return newServiceError(http.StatusConflict, "通话已结束")
+	}
+	if req.To == userID || !call.IsInvitee(req.To) {
+		return newServiceError(http.StatusBadRequest, "信令接收者不在该通话中")
+	}
+	// 双方当前都必须仍是好友或群组成员
+	if err := checkCallAccess(call, userID); err != nil {
+		return err
+	}
+	if call.Type == models.MessageTypeGroup {
+		if err := checkGroupMembership(req.To, call.GroupID); err != nil {
+			return newServiceError(http.StatusBadRequest, "信令接收者已不在该群组中")
+		}
+	}
+
+	hub.Notify(req.To, callSignalEvent, map[string]interface{}{
+		"callId": req.CallID,
+		"from":   userID,
+		"kind":   req.Kind,
+		"data":   req.Data,
+	})
+	return nil
+}
+
+// StartCall 发起通话
+func StartCall(c *gin.Context) {
+	userID := c.GetString("userId")
+
+	var req StartCallRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数无效"})
+		return
+	}
+
+	hub := c.MustGet("wsHub").(*websocket.Hub)
+	call, err := startCall(hub, userID, &req)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"call": call})
+}
+
+// AcceptCall 接听通话
+func AcceptCall(c *gin.Context) {
+	hub := c.MustGet("wsHub").(*websocket.Hub)
+	call, err := acceptCall(hub, c.GetString("userId"), c.Param("callId"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"call": call})
+}
+
+// RejectCall 拒绝来电
+func RejectCall(c *gin.Context) {
+	hub := c.MustGet("wsHub").(*websocket.Hub)
+	call, err := rejectCall(hub, c.GetString("userId"), c.Param("callId"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"call": call})
+}
+
+// EndCall 挂断通话
+func EndCall(c *gin.Context) {
+	hub := c.MustGet("wsHub").(*websocket.Hub)
+	call, err := endCall(hub, c.GetString("userId"), c.Param("callId"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"call": call})
+}
+
+// SendCallSignal 转发WebRTC信令
+func SendCallSignal(c *gin.Context) {
+	var req CallSignalRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数无效"})
+		return
+	}
+	req.CallID = c.Param("callId")
+
+	hub := c.MustGet("wsHub").(*websocket.Hub)
+	if err := relayCallSignal(hub, c.GetString("userId"), &req); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "信令已转发"})
+}
+
+// wsStartCall 通过WebSocket发起通话
+func wsStartCall(c *websocket.Client, payload json.RawMessage) (interface{}, error) {
+	var req StartCallRequest
+	if err := bindWSPayload(payload, &req); err != nil {
+		return nil, err
+	}
+
+	call, err := startCall(c.Hub, c.UserID, &req)
+	if err != nil {
+		return nil, wsError(err)
+	}
+
+	return gin.H{"call": call}, nil
+}
+
+// wsCallAction 将接听、拒绝和挂断包装为WebSocket处理器
+func wsCallAction(action func(hub *websocket.Hub, userID, callID string) (*models.Call, error)) websocket.HandlerFunc {
+	return func(c *websocket.Client, payload json.RawMessage) (interface{}, error) {
+		var req CallActionRequest
+		if err := bindWSPayload(payload, &req); err != nil {
+			return nil, err
+		}
+
+		call, err := action(c.Hub, c.UserID, req.CallID)
+		if err != nil {
+			return nil, wsError(err)
+		}
+
+		return gin.H{"call": call}, nil
+	}
+}
+
+// wsCallSignal 通过WebSocket转发WebRTC信令
+func wsCallSignal(c *websocket.Client, payload json.RawMessage) (interface{}, error) {
+	var req CallSignalRequest
+	if err := bindWSPayload(payload, &req); err != nil {
+		return nil, err
+	}
+
+	if err := relayCallSignal(c.Hub, c.UserID, &req); err != nil {
+		return nil, wsError(err)
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,133 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yourusername/gin-vue-chat/models"
+	"github.com/yourusername/gin-vue-chat/websocket"
+)
+
+// 会话设置变化事件类型，推送给用户的其他设备
+const eventTypeConversationUpdated = "conversation_updated"
+
+// UpdateConversationRequest 修改会话设置请求，未提供的字段不修改
+type UpdateConversationRequest struct {
+	Muted  *bool `json:"muted"`
+	Pinned *bool `json:"pinned"`
+}
+
+// GetConversations 获取会话列表，包括最后一条消息、未读数和免打扰、置顶设置。
+// 已不是好友或已退出的群组不会返回
+func GetConversations(c *gin.Context) {
+	userID := c.GetString("userId")
+
+	conversations, err := models.GetConversations(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取会话列表失败"})
+		return
+	}
+
+	friendships, err := models.GetFriendships(userID, "accepted")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取会话列表失败"})
+		return
+	}
+	friendIDs := make(map[string]bool, len(friendships))
+	for _, friendship := range friendships {
+		if friendship.UserID == userID {
+			friendIDs[friendship.FriendID] = true
+		} else {
+			friendIDs[friendship.UserID] = true
+		}
+	}
+
+	groups, err := models.GetUserGroups(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取会话列表失败"})
+		return
+	}
+	groupsByID := make(map[string]*models.Group, len(groups))
+	for _, group := range groups {
+		groupsByID[group.ID.Hex()] = group
+	}
+
+	result := make([]gin.H, 0, len(conversations))
+	for _, conversation := range conversations {
+		var name, avatar string
+		if conversation.Type == models.MessageTypeGroup {
+			group, ok := groupsByID[conversation.TargetID]
+			if !ok {
+				continue
+			}
+			name, avatar = group.Name, group.Avatar
+		} else {
+			if !friendIDs[conversation.TargetID] {
+				continue
+			}
+			user, err := models.GetUserByID(conversation.TargetID)
+			if err != nil {
+				continue
+			}
+			name, avatar = user.Username, user.Avatar
+		}
+
+		result = append(result, gin.H{
+			"type":           conversation.Type,
+			"targetId":       conversation.TargetID,
+			"name":           name,
+			"avatar":         avatar,
+			"lastMessage":    conversation.LastMessage,
+			"lastActivityAt": conversation.LastActivityAt,
+			"unreadCount":    conversation.UnreadCount,
+			"muted":          conversation.Muted,
+			"pinned":         conversation.Pinned,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"conversations": result})
+}
+
+// UpdateConversation 修改会话的免打扰和置顶设置
+func UpdateConversation(c *gin.Context) {
+	userID := c.GetString("userId")
+	conversationType := c.Param("type")
+	targetID := c.Param("targetId")
+
+	if conversationType != models.MessageTypePrivate && conversationType != models.MessageTypeGroup {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数无效"})
+		return
+	}
+
+	var req UpdateConversationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数无效"})
+		return
+	}
+
+	if err := checkConversationAccess(userID, conversationType, targetID); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	conversation, err := models.UpdateConversationSettings(userID, conversationType, targetID, req.Muted, req.Pinned)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "修改会话设置失败"})
+		return
+	}
+
+	// 免打扰的群组不再实时推送新消息，取消后重新订阅
+	hub := c.MustGet("wsHub").(*websocket.Hub)
+	if conversationType == models.MessageTypeGroup && req.Muted != nil {
+		if *req.Muted {
+			hub.LeaveRoom(userID, groupMessagesRoom(targetID))
+		} else {
+			hub.JoinRoom(userID, groupMessagesRoom(targetID))
+		}
+	}
+
+	// 同步到用户的其他设备
+	hub.Notify(userID, eventTypeConversationUpdated, gin.H{"conversation": conversation})
+
+	c.JSON(http.StatusOK, gin.H{"conversation": conversation})
+}
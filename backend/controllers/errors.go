@@ -0,0 +1,33 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// serviceError 携带HTTP状态码的业务错误，REST和WebSocket处理器共用
+type serviceError struct {
+	status  int
+	message string
+}
+
+func (e *serviceError) Error() string {
+	return e.message
+}
+
+// newServiceError 创建业务错误
+func newServiceError(status int, message string) error {
+	return &serviceError{status: status, message: message}
+}
+
+// respondError 将业务错误写入HTTP响应
+func respondError(c *gin.Context, err error) {
+	var se *serviceError
+	if errors.As(err, &se) {
+		c.JSON(se.status, gin.H{"error": se.message})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "服务器错误"})
+}
@@ -0,0 +1,32 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yourusername/gin-vue-chat/websocket"
+)
+
+// EventAckRequest 事件确认请求，SSE和长轮询客户端通过它确认收到的事件
+type EventAckRequest struct {
+	IDs []string `json:"ids" binding:"required,min=1"`
+}
+
+// AckEvents 确认事件已处理，未确认的事件会在重新连接时重放
+func AckEvents(c *gin.Context) {
+	userID := c.GetString("userId")
+
+	var req EventAckRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数无效"})
+		return
+	}
+
+	hub := c.MustGet("wsHub").(*websocket.Hub)
+	if err := hub.AckEvents(userID, req.IDs); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "确认事件失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "事件已确认"})
+}
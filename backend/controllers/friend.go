@@ -1,6 +1,7 @@
 package controllers
 
 import (
+	"log"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -40,10 +41,11 @@ func GetFriends(c *gin.Context) {
 		}
 
 		friends = append(friends, gin.H{
-			"id":       friend.ID.Hex(),
-			"username": friend.Username,
-			"avatar":   friend.Avatar,
-			"status":   friend.Status,
+			"id":         friend.ID.Hex(),
+			"username":   friend.Username,
+			"avatar":     friend.Avatar,
+			"status":     friend.Status,
+			"lastSeenAt": friend.LastSeenAt,
 		})
 	}
 
@@ -92,6 +94,13 @@ func AddFriend(c *gin.Context) {
 		return
 	}
 
+	// 新的私聊会话出现在双方的会话列表中
+	for _, pair := range [][2]string{{userID, friend.ID.Hex()}, {friend.ID.Hex(), userID}} {
+		if err := models.TouchConversation(pair[0], models.MessageTypePrivate, pair[1], friendship.UpdatedAt); err != nil {
+			log.Printf("更新会话列表失败: %v", err)
+		}
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"message": "好友添加成功",
 		"friend": gin.H{
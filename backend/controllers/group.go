@@ -1,10 +1,12 @@
 package controllers
 
 import (
+	"log"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 	"github.com/yourusername/gin-vue-chat/models"
+	"github.com/yourusername/gin-vue-chat/websocket"
 )
 
 // CreateGroupRequest 创建群组请求
@@ -85,6 +87,15 @@ func CreateGroup(c *gin.Context) {
 		return
 	}
 
+	// 创建者的连接订阅新群组
+	hub := c.MustGet("wsHub").(*websocket.Hub)
+	joinGroupRooms(hub, userID, group.ID.Hex())
+
+	// 新群组出现在创建者的会话列表中
+	if err := models.TouchConversation(userID, models.MessageTypeGroup, group.ID.Hex(), group.CreatedAt); err != nil {
+		log.Printf("更新会话列表失败: %v", err)
+	}
+
 	c.JSON(http.StatusCreated, gin.H{
 		"message": "群组创建成功",
 		"group": gin.H{
@@ -226,6 +237,7 @@ func DeleteGroup(c *gin.Context) {
 	}
 
 	// 删除群组成员 (在MongoDB中是逻辑删除)
+	hub := c.MustGet("wsHub").(*websocket.Hub)
 	members, err := models.GetGroupMembers(groupID)
 	for _, member := range members {
 		err = models.RemoveGroupMember(groupID, member.UserID)
@@ -233,6 +245,10 @@ func DeleteGroup(c *gin.Context) {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "删除群组成员失败"})
 			return
 		}
+		leaveGroupRooms(hub, member.UserID, groupID)
+		if err := models.DeleteConversation(member.UserID, models.MessageTypeGroup, groupID); err != nil {
+			log.Printf("更新会话列表失败: %v", err)
+		}
 	}
 
 	// 删除群组 (在MongoDB中是逻辑删除)
@@ -242,6 +258,11 @@ func DeleteGroup(c *gin.Context) {
 		return
 	}
 
+	// 记录群组解散供客户端同步
+	if err := models.RecordGroupEvent(groupID, models.ConversationEventGroupDeleted, userID, nil); err != nil {
+		log.Printf("记录群组变化失败: %v", err)
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "群组已删除"})
 }
 
@@ -281,11 +302,12 @@ func GetGroupMembers(c *gin.Context) {
 		}
 
 		memberList = append(memberList, gin.H{
-			"id":       user.ID.Hex(),
-			"username": user.Username,
-			"avatar":   user.Avatar,
-			"status":   user.Status,
-			"role":     member.Role,
+			"id":         user.ID.Hex(),
+			"username":   user.Username,
+			"avatar":     user.Avatar,
+			"status":     user.Status,
+			"lastSeenAt": user.LastSeenAt,
+			"role":       member.Role,
 		})
 	}
 
@@ -348,6 +370,21 @@ func AddGroupMember(c *gin.Context) {
 		return
 	}
 
+	// 新成员的连接订阅该群组
+	hub := c.MustGet("wsHub").(*websocket.Hub)
+	joinGroupRooms(hub, user.ID.Hex(), groupID)
+	if err := models.TouchConversation(user.ID.Hex(), models.MessageTypeGroup, groupID, newMember.CreatedAt); err != nil {
+		log.Printf("更新会话列表失败: %v", err)
+	}
+
+	// 记录成员变化供客户端同步
+	if err := models.RecordGroupEvent(groupID, models.ConversationEventMemberAdded, userID, map[string]interface{}{
+		"userId": user.ID.Hex(),
+		"role":   newMember.Role,
+	}); err != nil {
+		log.Printf("记录群组成员变化失败: %v", err)
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"message": "成员添加成功",
 		"member": gin.H{
@@ -422,5 +459,19 @@ func RemoveGroupMember(c *gin.Context) {
 		return
 	}
 
+	// 被移除成员的连接不再接收该群组的消息
+	hub := c.MustGet("wsHub").(*websocket.Hub)
+	leaveGroupRooms(hub, memberID, groupID)
+	if err := models.DeleteConversation(memberID, models.MessageTypeGroup, groupID); err != nil {
+		log.Printf("更新会话列表失败: %v", err)
+	}
+
+	// 记录成员变化供客户端同步
+	if err := models.RecordGroupEvent(groupID, models.ConversationEventMemberRemoved, userID, map[string]interface{}{
+		"userId": memberID,
+	}); err != nil {
+		log.Printf("记录群组成员变化失败: %v", err)
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "成员已移除"})
 }
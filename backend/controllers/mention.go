@@ -0,0 +1,146 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yourusername/gin-vue-chat/models"
+	"github.com/yourusername/gin-vue-chat/websocket"
+)
+
+// @提醒事件类型，单独推送给被@的成员，不受群组免打扰影响
+const eventTypeMention = "mention"
+
+// mentionPattern 匹配消息中的"@用户名"，用户名在空白、@或常见标点处结束。
+// @前面是字母或数字时不匹配，避免把邮箱地址当作@
+var mentionPattern = regexp.MustCompile(`(?:^|[^A-Za-z0-9_.])@([^\s@,.!?;:，。！？；：、]+)`)
+
+// mentionAllNames 表示@所有人的关键字
+var mentionAllNames = map[string]bool{"all": true, "所有人": true}
+
+// 单条消息最多解析的被@用户名数量，超出的按普通文本处理
+const maxMentionNames = 20
+
+// parseMentions 从消息内容中解析被@的用户名，以及是否@所有人
+func parseMentions(content string) ([]string, bool) {
+	var names []string
+	all := false
+	seen := make(map[string]bool)
+	for _, match := range mentionPattern.FindAllStringSubmatch(content, -1) {
+		name := match[1]
+		if mentionAllNames[name] {
+			all = true
+			continue
+		}
+		if !seen[name] && len(names) < maxMentionNames {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names, all
+}
+
+// attachMentions 解析群聊消息中@的成员，只有群组管理员可以@所有人。
+// 不是群组成员的用户名按普通文本处理。消息中有@时返回加载的群组成员，
+// 由调用方传给notifyMentions，避免重复查询
+func attachMentions(message *models.Message) ([]*models.GroupMember, error) {
+	names, all := parseMentions(message.Content)
+	if !all && len(names) == 0 {
+		return nil, nil
+	}
+
+	members, err := models.GetGroupMembers(message.GroupID)
+	if err != nil {
+		return nil, newServiceError(http.StatusInternalServerError, "服务器错误")
+	}
+	isMember := make(map[string]bool, len(members))
+	isAdmin := false
+	for _, member := range members {
+		isMember[member.UserID] = true
+		if member.UserID == message.SenderID && member.Role == "admin" {
+			isAdmin = true
+		}
+	}
+
+	if all {
+		if !isAdmin {
+			return nil, newServiceError(http.StatusForbidden, "只有群组管理员可以@所有人")
+		}
+		message.MentionAll = true
+	}
+
+	if len(names) == 0 {
+		return members, nil
+	}
+
+	// 一次查询解析所有用户名，按消息中出现的顺序记录
+	users, err := models.GetUsersByUsernames(names)
+	if err != nil {
+		return nil, newServiceError(http.StatusInternalServerError, "服务器错误")
+	}
+	userIDs := make(map[string]string, len(users))
+	for _, user := range users {
+		userIDs[user.Username] = user.ID.Hex()
+	}
+	for _, name := range names {
+		userID, ok := userIDs[name]
+		if ok && isMember[userID] && userID != message.SenderID {
+			message.Mentions = append(message.Mentions, userID)
+		}
+	}
+	return members, nil
+}
+
+// notifyMentions 给被@的成员单独推送需要确认的优先提醒事件，不受免打扰和丢帧策略影响。
+// members为attachMentions返回的群组成员，@所有人时推送给其中除发送者外的所有成员
+func notifyMentions(hub *websocket.Hub, message *models.Message, members []*models.GroupMember) {
+	recipients := message.Mentions
+	if message.MentionAll {
+		recipients = make([]string, 0, len(members))
+		for _, member := range members {
+			recipients = append(recipients, member.UserID)
+		}
+	}
+	if len(recipients) == 0 {
+		return
+	}
+
+	userIDs := make([]string, 0, len(recipients))
+	for _, userID := range recipients {
+		if userID != message.SenderID {
+			userIDs = append(userIDs, userID)
+		}
+	}
+	if err := hub.DeliverPriority(message.ID.Hex(), userIDs, eventTypeMention, groupMessageEvent(message)); err != nil {
+		log.Printf("@提醒推送失败: %v", err)
+	}
+}
+
+// GetMentions 获取@当前用户的群聊消息
+func GetMentions(c *gin.Context) {
+	userID := c.GetString("userId")
+
+	// 获取分页参数
+	query, err := parseMessagePage(c)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	// 只返回用户仍在的群组中的消息
+	groupIDs, err := userGroupIDs(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "服务器错误"})
+		return
+	}
+
+	page, err := models.GetMentions(userID, groupIDs, query)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取消息失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, messagePageResponse(page))
+}
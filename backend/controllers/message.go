@@ -1,7 +1,6 @@
 package controllers
 
 import (
-	"encoding/json"
 	"log"
 	"net/http"
 	"strconv"
@@ -9,353 +8,508 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/yourusername/gin-vue-chat/models"
 	"github.com/yourusername/gin-vue-chat/websocket"
-	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 // SendPrivateMessageRequest 发送私聊消息请求
 type SendPrivateMessageRequest struct {
 	ReceiverID string `json:"receiverId" binding:"required"`
 	Content    string `json:"content" binding:"required"`
+	ReplyToID  string `json:"replyToId"` // 回复的消息ID
 }
 
 // SendGroupMessageRequest 发送群聊消息请求
 type SendGroupMessageRequest struct {
-	GroupID string `json:"groupId" binding:"required"`
-	Content string `json:"content" binding:"required"`
+	GroupID   string `json:"groupId" binding:"required"`
+	Content   string `json:"content" binding:"required"`
+	ReplyToID string `json:"replyToId"` // 回复的消息ID
+	ThreadID  string `json:"threadId"`  // 话题根消息ID，不为空时作为话题回复发送
 }
 
-// GetPrivateMessages 获取私聊消息
-func GetPrivateMessages(c *gin.Context) {
-	userID := c.GetString("userId")
-	receiverID := c.Param("userId")
-
-	// 检查接收者是否存在
-	_, err := models.GetUserByID(receiverID)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
-		return
-	}
-
-	// 检查是否是好友关系
+// checkFriendship 检查两个用户是否为好友关系
+func checkFriendship(userID, friendID string) error {
 	friendships, err := models.GetFriendships(userID, "accepted")
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "服务器错误"})
-		return
+		return newServiceError(http.StatusInternalServerError, "服务器错误")
 	}
 
-	// 验证是否为好友
-	isFriend := false
 	for _, friendship := range friendships {
-		if (friendship.UserID == userID && friendship.FriendID == receiverID) ||
-			(friendship.UserID == receiverID && friendship.FriendID == userID) {
-			isFriend = true
-			break
+		if (friendship.UserID == userID && friendship.FriendID == friendID) ||
+			(friendship.UserID == friendID && friendship.FriendID == userID) {
+			return nil
 		}
 	}
 
-	// 如果不是好友，返回错误
-	if !isFriend {
-		c.JSON(http.StatusForbidden, gin.H{"error": "您不是该用户的好友"})
-		return
+	return newServiceError(http.StatusForbidden, "您不是该用户的好友")
+}
+
+// checkGroupMembership 检查群组是否存在以及用户是否是群组成员
+func checkGroupMembership(userID, groupID string) error {
+	// 检查群组是否存在
+	if _, err := models.GetGroupByID(groupID); err != nil {
+		return newServiceError(http.StatusNotFound, "群组不存在")
 	}
 
-	// 获取分页参数
-	limit := int64(20) // 默认每页20条
-	if limitStr := c.Query("limit"); limitStr != "" {
-		if l, err := strconv.ParseInt(limitStr, 10, 64); err == nil && l > 0 {
-			limit = l
-		}
+	// 获取用户所在的群组
+	userGroups, err := models.GetUserGroups(userID)
+	if err != nil {
+		return newServiceError(http.StatusInternalServerError, "服务器错误")
 	}
 
-	skip := int64(0) // 默认从第一条开始
-	if skipStr := c.Query("skip"); skipStr != "" {
-		if s, err := strconv.ParseInt(skipStr, 10, 64); err == nil && s >= 0 {
-			skip = s
+	// 验证用户是否在群组中
+	for _, g := range userGroups {
+		if g.ID.Hex() == groupID {
+			return nil
 		}
 	}
 
-	// 获取消息
-	messages, err := models.GetPrivateMessages(userID, receiverID, limit, skip)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取消息失败"})
-		return
-	}
+	return newServiceError(http.StatusForbidden, "您不是该群组的成员")
+}
 
-	c.JSON(http.StatusOK, gin.H{"messages": messages})
+// checkConversationAccess 检查用户是否有权访问会话，targetID私聊时为对方用户ID，群聊时为群组ID
+func checkConversationAccess(userID, conversationType, targetID string) error {
+	if conversationType == models.MessageTypeGroup {
+		return checkGroupMembership(userID, targetID)
+	}
+	return checkFriendship(userID, targetID)
 }
 
-// SendPrivateMessage 发送私聊消息
-func SendPrivateMessage(c *gin.Context) {
-	senderID := c.GetString("userId")
+// checkMessageAccess 检查用户是否有权访问消息所在的会话
+func checkMessageAccess(userID string, message *models.Message) error {
+	if message.Type == models.MessageTypeGroup {
+		return checkConversationAccess(userID, message.Type, message.GroupID)
+	}
 
-	var req SendPrivateMessageRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数无效"})
-		return
+	// 私聊消息只有会话双方可以访问，对方的其他好友不能访问
+	var peerID string
+	switch userID {
+	case message.SenderID:
+		peerID = message.ReceiverID
+	case message.ReceiverID:
+		peerID = message.SenderID
+	default:
+		return newServiceError(http.StatusForbidden, "您不在该会话中")
 	}
+	return checkConversationAccess(userID, message.Type, peerID)
+}
 
-	// 检查接收者是否存在
-	_, err := models.GetUserByID(req.ReceiverID)
+// inConversation 检查消息是否属于用户的会话，targetID私聊时为对方用户ID，群聊时为群组ID
+func inConversation(message *models.Message, conversationType, userID, targetID string) bool {
+	if message.Type != conversationType {
+		return false
+	}
+	if conversationType == models.MessageTypeGroup {
+		return message.GroupID == targetID
+	}
+	return (message.SenderID == userID && message.ReceiverID == targetID) ||
+		(message.SenderID == targetID && message.ReceiverID == userID)
+}
+
+// checkGroupAdmin 检查用户是否是群组管理员
+func checkGroupAdmin(userID, groupID string) error {
+	members, err := models.GetGroupMembers(groupID)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "接收者不存在"})
-		return
+		return newServiceError(http.StatusInternalServerError, "服务器错误")
 	}
 
-	// 检查是否是好友关系
-	friendships, err := models.GetFriendships(senderID, "accepted")
+	for _, member := range members {
+		if member.UserID == userID && member.Role == "admin" {
+			return nil
+		}
+	}
+
+	return newServiceError(http.StatusForbidden, "您不是该群组的管理员")
+}
+
+// senderInfo 构建推送消息中的发送者信息
+func senderInfo(senderID string) map[string]interface{} {
+	sender, err := models.GetUserByID(senderID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "服务器错误"})
-		return
+		return map[string]interface{}{"id": senderID}
 	}
 
-	// 验证是否为好友
-	isFriend := false
-	for _, friendship := range friendships {
-		if (friendship.UserID == senderID && friendship.FriendID == req.ReceiverID) ||
-			(friendship.UserID == req.ReceiverID && friendship.FriendID == senderID) {
-			isFriend = true
-			break
+	return map[string]interface{}{
+		"id":       sender.ID,
+		"username": sender.Username,
+		"avatar":   sender.Avatar,
+	}
+}
+
+// senderInfos 批量获取用户的基本信息，按用户ID索引，只查询一次数据库。
+// 查询失败或用户不存在时只包含ID
+func senderInfos(userIDs []string) map[string]map[string]interface{} {
+	infos := make(map[string]map[string]interface{}, len(userIDs))
+	for _, userID := range userIDs {
+		infos[userID] = map[string]interface{}{"id": userID}
+	}
+
+	users, err := models.GetUsersByIDs(userIDs)
+	if err != nil {
+		log.Printf("批量获取用户失败: %v", err)
+		return infos
+	}
+	for _, user := range users {
+		infos[user.ID.Hex()] = map[string]interface{}{
+			"id":       user.ID,
+			"username": user.Username,
+			"avatar":   user.Avatar,
 		}
 	}
+	return infos
+}
 
-	if !isFriend {
-		c.JSON(http.StatusForbidden, gin.H{"error": "您不是该用户的好友"})
-		return
+// privateMessageEvent 构建推送给客户端的私聊消息事件
+func privateMessageEvent(message *models.Message) map[string]interface{} {
+	event := map[string]interface{}{
+		"id":        message.ID.Hex(),
+		"from":      message.SenderID,
+		"to":        message.ReceiverID,
+		"content":   message.Content,
+		"timestamp": message.Timestamp,
+		"sender":    senderInfo(message.SenderID),
+	}
+	if message.ContentType != "" {
+		event["contentType"] = message.ContentType
+		event["call"] = message.Call
+	}
+	if message.ReplyTo != nil {
+		event["replyTo"] = message.ReplyTo
 	}
+	return map[string]interface{}{"message": event}
+}
 
-	// 保存消息到MongoDB
-	message, err := models.SavePrivateMessage(senderID, req.ReceiverID, req.Content)
+// groupMessageEvent 构建推送给客户端的群聊消息事件
+func groupMessageEvent(message *models.Message) map[string]interface{} {
+	event := map[string]interface{}{
+		"id":        message.ID.Hex(),
+		"groupId":   message.GroupID,
+		"senderId":  message.SenderID,
+		"content":   message.Content,
+		"timestamp": message.Timestamp,
+		"sender":    senderInfo(message.SenderID),
+	}
+	if message.ContentType != "" {
+		event["contentType"] = message.ContentType
+		event["call"] = message.Call
+	}
+	if message.ReplyTo != nil {
+		event["replyTo"] = message.ReplyTo
+	}
+	if message.ThreadID != "" {
+		event["threadId"] = message.ThreadID
+	}
+	if len(message.Mentions) > 0 {
+		event["mentions"] = message.Mentions
+	}
+	if message.MentionAll {
+		event["mentionAll"] = true
+	}
+	return map[string]interface{}{"message": event}
+}
+
+// messageRef 构建消息相关事件中标识消息及其所在会话的字段
+func messageRef(message *models.Message) map[string]interface{} {
+	ref := map[string]interface{}{
+		"id":       message.ID.Hex(),
+		"type":     message.Type,
+		"senderId": message.SenderID,
+	}
+	if message.Type == models.MessageTypeGroup {
+		ref["groupId"] = message.GroupID
+	} else {
+		ref["receiverId"] = message.ReceiverID
+	}
+	return ref
+}
+
+// publishMessageChange 记录已发送消息的变化并推送给会话双方或群组所有成员，
+// 包括操作者的其他设备。离线用户通过增量同步获取变化
+func publishMessageChange(hub *websocket.Hub, message *models.Message, actorID, conversationEvent, eventType string, event, data map[string]interface{}) {
+	var err error
+	if message.Type == models.MessageTypeGroup {
+		err = models.RecordGroupEvent(message.GroupID, conversationEvent, actorID, data)
+	} else {
+		err = models.RecordPrivateEvent(message.SenderID, message.ReceiverID, conversationEvent, actorID, data)
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存消息失败"})
+		log.Printf("记录消息变化失败: %v", err)
+	}
+
+	pushMessageEvent(hub, message, eventType, event)
+}
+
+// deliverToGroup 推送与群聊消息相关的需要确认的事件给群组房间中的所有成员，exceptUserID不为空时跳过该成员
+func deliverToGroup(hub *websocket.Hub, message *models.Message, eventType string, payload interface{}, exceptUserID string) error {
+	return hub.DeliverToRoom(message.ID.Hex(), message.GroupID, eventType, payload, exceptUserID)
+}
+
+// sendToGroupMessagesRoom 推送群聊新消息给订阅了群组消息房间的成员，exceptUserID不为空时跳过该成员
+func sendToGroupMessagesRoom(hub *websocket.Hub, message *models.Message, exceptUserID string) error {
+	return hub.DeliverToRoom(message.ID.Hex(), groupMessagesRoom(message.GroupID), models.MessageTypeGroup, groupMessageEvent(message), exceptUserID)
+}
+
+// pushMessageEvent 推送与已发送消息相关的事件给会话双方或群组所有成员
+func pushMessageEvent(hub *websocket.Hub, message *models.Message, eventType string, event map[string]interface{}) {
+	if message.Type == models.MessageTypeGroup {
+		if err := deliverToGroup(hub, message, eventType, event, ""); err != nil {
+			log.Printf("消息变化推送失败: %v", err)
+		}
 		return
 	}
+	recipients := []string{message.SenderID, message.ReceiverID}
+	if err := hub.DeliverRef(message.ID.Hex(), recipients, eventType, event); err != nil {
+		log.Printf("消息变化推送失败: %v", err)
+	}
+}
 
-	// 获取发送者信息
-	sender, _ := models.GetUserByID(senderID)
+// sendPrivateMessage 校验并保存私聊消息，然后通过WebSocket推送给接收者
+func sendPrivateMessage(hub *websocket.Hub, senderID string, req *SendPrivateMessageRequest) (*models.Message, error) {
+	receiverID := req.ReceiverID
 
-	// 通过WebSocket发送消息给接收者
-	wsMessage := map[string]interface{}{
-		"type": "private",
-		"message": map[string]interface{}{
-			"id":        message.ID.Hex(),
-			"from":      senderID,
-			"to":        req.ReceiverID,
-			"content":   req.Content,
-			"timestamp": message.Timestamp,
-			"sender": map[string]interface{}{
-				"id":       sender.ID,
-				"username": sender.Username,
-				"avatar":   sender.Avatar,
-			},
-		},
+	// 检查接收者是否存在
+	if _, err := models.GetUserByID(receiverID); err != nil {
+		return nil, newServiceError(http.StatusNotFound, "接收者不存在")
 	}
 
-	// 获取WebSocket Hub
-	hub := c.MustGet("wsHub").(*websocket.Hub)
+	// 检查是否是好友关系
+	if err := checkFriendship(senderID, receiverID); err != nil {
+		return nil, err
+	}
 
-	// 发送消息给接收者
-	// 将消息转换为JSON字符串，再转换为字节数组
-	jsonData, err := json.Marshal(gin.H{"data": wsMessage})
+	message := &models.Message{
+		Type:       models.MessageTypePrivate,
+		SenderID:   senderID,
+		ReceiverID: receiverID,
+		Content:    req.Content,
+	}
+	if err := attachReplyTo(message, req.ReplyToID); err != nil {
+		return nil, err
+	}
+
+	// 保存消息到MongoDB
+	message, err := models.SaveMessage(message)
 	if err != nil {
-		// 记录错误但继续执行，因为这不是致命错误
-		log.Printf("消息序列化失败: %v", err)
-		return
+		return nil, newServiceError(http.StatusInternalServerError, "保存消息失败")
 	}
-	hub.SendToUser(req.ReceiverID, jsonData)
 
-	c.JSON(http.StatusOK, gin.H{
-		"message": "消息发送成功",
-		"data":    message,
-	})
+	// 通过WebSocket发送消息给接收者，接收者确认前会在重连时重放
+	if err := hub.DeliverRef(message.ID.Hex(), []string{receiverID}, models.MessageTypePrivate, privateMessageEvent(message)); err != nil {
+		// 记录错误但继续执行，消息已经保存
+		log.Printf("消息推送失败: %v", err)
+	}
+
+	return message, nil
 }
 
-// GetGroupMessages 获取群聊消息
-func GetGroupMessages(c *gin.Context) {
-	userID := c.GetString("userId")
-	groupID := c.Param("groupId")
+// sendGroupMessage 校验并保存群聊消息，然后通过WebSocket推送给群组其他成员
+func sendGroupMessage(hub *websocket.Hub, senderID string, req *SendGroupMessageRequest) (*models.Message, error) {
+	groupID := req.GroupID
 
-	// 检查群组是否存在
-	_, err := models.GetGroupByID(groupID)
+	// 检查用户是否是群组成员
+	if err := checkGroupMembership(senderID, groupID); err != nil {
+		return nil, err
+	}
+
+	message := &models.Message{
+		Type:     models.MessageTypeGroup,
+		SenderID: senderID,
+		GroupID:  groupID,
+		Content:  req.Content,
+	}
+	var root *models.Message
+	if req.ThreadID != "" {
+		var err error
+		if root, err = loadThreadRoot(req.ThreadID, groupID); err != nil {
+			return nil, err
+		}
+		message.ThreadID = root.ID.Hex()
+	}
+	if err := attachReplyTo(message, req.ReplyToID); err != nil {
+		return nil, err
+	}
+	members, err := attachMentions(message)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "群组不存在"})
-		return
+		return nil, err
 	}
 
-	// 检查用户是否是群组成员
-	// 获取用户所在的群组
-	userGroups, err := models.GetUserGroups(userID)
+	// 保存消息到MongoDB
+	message, err = models.SaveMessage(message)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "服务器错误"})
-		return
+		return nil, newServiceError(http.StatusInternalServerError, "保存消息失败")
 	}
 
-	// 验证用户是否在群组中
-	isMember := false
-	for _, g := range userGroups {
-		if g.ID.Hex() == groupID {
-			isMember = true
-			break
-		}
+	if root != nil {
+		notifyThreadReply(hub, root, message)
 	}
 
-	if !isMember {
-		c.JSON(http.StatusForbidden, gin.H{"error": "您不是该群组的成员"})
-		return
+	// 通过群组的消息房间推送给群组成员，消息只编码和保存一次，成员确认前会在重连时重放。
+	// 设置了免打扰的成员不订阅消息房间，被@时仍会收到提醒
+	if err := sendToGroupMessagesRoom(hub, message, senderID); err != nil {
+		log.Printf("消息推送失败: %v", err)
 	}
 
-	// 获取分页参数
-	limit := int64(20) // 默认每页20条
+	notifyMentions(hub, message, members)
+
+	return message, nil
+}
+
+// parseMessagePage 解析消息分页参数：limit、before和after游标
+func parseMessagePage(c *gin.Context) (*models.MessagePageQuery, error) {
+	query := &models.MessagePageQuery{Limit: models.DefaultMessagePageSize}
 	if limitStr := c.Query("limit"); limitStr != "" {
 		if l, err := strconv.ParseInt(limitStr, 10, 64); err == nil && l > 0 {
-			limit = l
+			query.Limit = l
 		}
 	}
+	if query.Limit > models.MaxMessagePageSize {
+		query.Limit = models.MaxMessagePageSize
+	}
 
-	skip := int64(0) // 默认从第一条开始
-	if skipStr := c.Query("skip"); skipStr != "" {
-		if s, err := strconv.ParseInt(skipStr, 10, 64); err == nil && s >= 0 {
-			skip = s
+	if before := c.Query("before"); before != "" {
+		cursor, err := models.ParseMessageCursor(before)
+		if err != nil {
+			return nil, newServiceError(http.StatusBadRequest, err.Error())
 		}
+		query.Before = cursor
 	}
-
-	// 获取消息
-	messages, err := models.GetGroupMessages(groupID, limit, skip)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取消息失败"})
-		return
+	if after := c.Query("after"); after != "" {
+		cursor, err := models.ParseMessageCursor(after)
+		if err != nil {
+			return nil, newServiceError(http.StatusBadRequest, err.Error())
+		}
+		query.After = cursor
 	}
 
-	c.JSON(http.StatusOK, gin.H{"messages": messages})
+	return query, nil
 }
 
-// SendGroupMessage 发送群聊消息
-func SendGroupMessage(c *gin.Context) {
-	senderID := c.GetString("userId")
-
-	var req SendGroupMessageRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数无效"})
-		return
+// messagePageResponse 构建分页响应，before和after游标分别指向本页最早和最新的消息
+func messagePageResponse(page *models.MessagePage) gin.H {
+	response := gin.H{
+		"messages": page.Messages,
+		"hasMore":  page.HasMore,
 	}
-
-	// 检查群组是否存在
-	_, err := models.GetGroupByID(req.GroupID)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "群组不存在"})
-		return
+	if len(page.Messages) > 0 {
+		response["cursors"] = gin.H{
+			"before": models.NewMessageCursor(page.Messages[0]).String(),
+			"after":  models.NewMessageCursor(page.Messages[len(page.Messages)-1]).String(),
+		}
 	}
+	return response
+}
 
-	// 检查用户是否是群组成员
-	// 获取用户所在的群组
-	userGroups, err := models.GetUserGroups(senderID)
+// GetPrivateMessages 获取私聊消息
+func GetPrivateMessages(c *gin.Context) {
+	userID := c.GetString("userId")
+	receiverID := c.Param("userId")
+
+	// 检查接收者是否存在
+	_, err := models.GetUserByID(receiverID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "服务器错误"})
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
 		return
 	}
 
-	// 验证用户是否在群组中
-	isMember := false
-	for _, g := range userGroups {
-		if g.ID.Hex() == req.GroupID {
-			isMember = true
-			break
-		}
+	// 检查是否是好友关系
+	if err := checkFriendship(userID, receiverID); err != nil {
+		respondError(c, err)
+		return
 	}
 
-	if !isMember {
-		c.JSON(http.StatusForbidden, gin.H{"error": "您不是该群组的成员"})
+	// 获取分页参数
+	query, err := parseMessagePage(c)
+	if err != nil {
+		respondError(c, err)
 		return
 	}
 
-	// 保存消息到MongoDB
-	message, err := models.SaveGroupMessage(senderID, req.GroupID, req.Content)
+	// 获取消息
+	page, err := models.GetPrivateMessages(userID, receiverID, query)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存消息失败"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取消息失败"})
 		return
 	}
 
-	// 获取发送者信息
-	sender, _ := models.GetUserByID(senderID)
+	response := messagePageResponse(page)
+	addReadCursors(response, models.MessageTypePrivate, userID, receiverID)
+	c.JSON(http.StatusOK, response)
+}
+
+// SendPrivateMessage 发送私聊消息
+func SendPrivateMessage(c *gin.Context) {
+	senderID := c.GetString("userId")
 
-	// 通过WebSocket发送消息给群组所有成员
-	wsMessage := map[string]interface{}{
-		"type": "group",
-		"message": map[string]interface{}{
-			"id":        message.ID.Hex(),
-			"groupId":   req.GroupID,
-			"senderId":  senderID,
-			"content":   req.Content,
-			"timestamp": message.Timestamp,
-			"sender": map[string]interface{}{
-				"id":       sender.ID,
-				"username": sender.Username,
-				"avatar":   sender.Avatar,
-			},
-		},
+	var req SendPrivateMessageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数无效"})
+		return
 	}
 
 	// 获取WebSocket Hub
 	hub := c.MustGet("wsHub").(*websocket.Hub)
 
-	// 获取群组所有成员
-	members, err := models.GetGroupMembers(req.GroupID)
+	message, err := sendPrivateMessage(hub, senderID, &req)
 	if err != nil {
-		log.Printf("获取群组成员失败: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "发送消息失败"})
+		respondError(c, err)
 		return
 	}
 
-	// 发送消息给所有成员
-	for _, member := range members {
-		if member.UserID != senderID { // 不需要发送给自己
-			jsonData, err := json.Marshal(gin.H{"data": wsMessage})
-			if err != nil {
-				log.Printf("消息序列化失败: %v", err)
-				continue
-			}
-			hub.SendToUser(member.UserID, jsonData)
-		}
-	}
-
 	c.JSON(http.StatusOK, gin.H{
 		"message": "消息发送成功",
 		"data":    message,
 	})
 }
 
-// MarkMessagesAsRead 标记消息为已读
-func MarkMessagesAsRead(c *gin.Context) {
-	// 获取消息ID列表
-	var req struct {
-		MessageIDs []string `json:"messageIds" binding:"required"`
+// GetGroupMessages 获取群聊消息
+func GetGroupMessages(c *gin.Context) {
+	userID := c.GetString("userId")
+	groupID := c.Param("groupId")
+
+	// 检查用户是否是群组成员
+	if err := checkGroupMembership(userID, groupID); err != nil {
+		respondError(c, err)
+		return
 	}
 
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数无效"})
+	// 获取分页参数
+	query, err := parseMessagePage(c)
+	if err != nil {
+		respondError(c, err)
 		return
 	}
 
-	// 转换字符串ID为ObjectID
-	objectIDs := make([]primitive.ObjectID, 0, len(req.MessageIDs))
-	for _, idStr := range req.MessageIDs {
-		id, err := primitive.ObjectIDFromHex(idStr)
-		if err != nil {
-			continue
-		}
-		objectIDs = append(objectIDs, id)
+	// 获取消息
+	page, err := models.GetGroupMessages(groupID, query)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取消息失败"})
+		return
 	}
 
-	if len(objectIDs) == 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的消息ID"})
+	response := messagePageResponse(page)
+	addReadCursors(response, models.MessageTypeGroup, userID, groupID)
+	c.JSON(http.StatusOK, response)
+}
+
+// SendGroupMessage 发送群聊消息
+func SendGroupMessage(c *gin.Context) {
+	senderID := c.GetString("userId")
+
+	var req SendGroupMessageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数无效"})
 		return
 	}
 
-	// 标记消息为已读
-	err := models.MarkMessagesAsRead(objectIDs)
+	// 获取WebSocket Hub
+	hub := c.MustGet("wsHub").(*websocket.Hub)
+
+	message, err := sendGroupMessage(hub, senderID, &req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "标记消息失败"})
+		respondError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "消息已标记为已读"})
+	c.JSON(http.StatusOK, gin.H{
+		"message": "消息发送成功",
+		"data":    message,
+	})
 }
@@ -0,0 +1,148 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yourusername/gin-vue-chat/config"
+	"github.com/yourusername/gin-vue-chat/models"
+	"github.com/yourusername/gin-vue-chat/websocket"
+)
+
+// 消息编辑事件类型
+const eventTypeMessageEdited = "message_edited"
+
+// EditMessageRequest 编辑消息请求
+type EditMessageRequest struct {
+	MessageID string `json:"messageId"`
+	Content   string `json:"content" binding:"required"`
+}
+
+// messageEditedEvent 构建推送给客户端的消息编辑事件
+func messageEditedEvent(message *models.Message) map[string]interface{} {
+	event := messageRef(message)
+	event["content"] = message.Content
+	event["editedAt"] = message.EditedAt
+	return map[string]interface{}{"message": event}
+}
+
+// editMessage 修改自己发送的消息，只能在发送后的编辑时限内修改
+func editMessage(hub *websocket.Hub, userID, messageID, content string) (*models.Message, error) {
+	message, err := models.GetMessageByID(messageID)
+	if err != nil {
+		return nil, newServiceError(http.StatusNotFound, "消息不存在")
+	}
+	if message.SenderID != userID {
+		return nil, newServiceError(http.StatusForbidden, "只能编辑自己发送的消息")
+	}
+	if message.Recalled() {
+		return nil, newServiceError(http.StatusBadRequest, "消息已撤回")
+	}
+	if message.ContentType != "" {
+		return nil, newServiceError(http.StatusBadRequest, "该消息不能编辑")
+	}
+	if time.Since(message.Timestamp) > config.AppConfig.Message.EditWindow {
+		return nil, newServiceError(http.StatusForbidden, "消息已超过可编辑时间")
+	}
+	if message.Content == content {
+		return message, nil
+	}
+
+	// 发送者仍需有权访问该会话
+	if err := checkMessageAccess(userID, message); err != nil {
+		return nil, err
+	}
+
+	updated, err := models.EditMessage(message, content)
+	if errors.Is(err, models.ErrMessageChanged) {
+		return nil, newServiceError(http.StatusConflict, err.Error())
+	}
+	if err != nil {
+		return nil, newServiceError(http.StatusInternalServerError, "编辑消息失败")
+	}
+
+	// 记录会话变化，离线的一方通过增量同步获取修改后的内容
+	data := map[string]interface{}{"messageId": updated.ID.Hex(), "content": updated.Content, "editedAt": updated.EditedAt}
+	publishMessageChange(hub, updated, userID, models.ConversationEventMessageEdited, eventTypeMessageEdited, messageEditedEvent(updated), data)
+
+	return updated, nil
+}
+
+// EditMessage 编辑消息
+func EditMessage(c *gin.Context) {
+	userID := c.GetString("userId")
+
+	var req EditMessageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数无效"})
+		return
+	}
+
+	hub := c.MustGet("wsHub").(*websocket.Hub)
+
+	message, err := editMessage(hub, userID, c.Param("messageId"), req.Content)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "消息编辑成功",
+		"data":    message,
+	})
+}
+
+// GetMessageRevisions 获取消息的编辑历史，只有发送者和群组管理员可以查看
+func GetMessageRevisions(c *gin.Context) {
+	userID := c.GetString("userId")
+
+	message, err := models.GetMessageByID(c.Param("messageId"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "消息不存在"})
+		return
+	}
+
+	if message.SenderID != userID {
+		if message.Type != models.MessageTypeGroup {
+			c.JSON(http.StatusForbidden, gin.H{"error": "无权查看该消息的编辑历史"})
+			return
+		}
+		if err := checkGroupAdmin(userID, message.GroupID); err != nil {
+			respondError(c, err)
+			return
+		}
+	}
+
+	revisions := message.Revisions
+	if revisions == nil {
+		revisions = []models.MessageRevision{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"messageId": message.ID.Hex(),
+		"content":   message.Content,
+		"editedAt":  message.EditedAt,
+		"revisions": revisions,
+	})
+}
+
+// wsEditMessage 通过WebSocket编辑消息
+func wsEditMessage(c *websocket.Client, payload json.RawMessage) (interface{}, error) {
+	var req EditMessageRequest
+	if err := bindWSPayload(payload, &req); err != nil {
+		return nil, err
+	}
+	if req.MessageID == "" {
+		return nil, websocket.NewError(http.StatusBadRequest, "请求参数无效")
+	}
+
+	message, err := editMessage(c.Hub, c.UserID, req.MessageID, req.Content)
+	if err != nil {
+		return nil, wsError(err)
+	}
+
+	return gin.H{"message": message}, nil
+}
@@ -0,0 +1,123 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yourusername/gin-vue-chat/config"
+	"github.com/yourusername/gin-vue-chat/models"
+	"github.com/yourusername/gin-vue-chat/websocket"
+)
+
+// 消息撤回事件类型
+const eventTypeMessageRecalled = "message_recalled"
+
+// RecallMessageRequest 撤回消息请求
+type RecallMessageRequest struct {
+	MessageID string `json:"messageId" binding:"required"`
+}
+
+// messageRecalledEvent 构建推送给客户端的消息撤回事件，客户端用撤回提示替换原消息
+func messageRecalledEvent(message *models.Message) map[string]interface{} {
+	event := messageRef(message)
+	event["recalledAt"] = message.RecalledAt
+	event["recalledBy"] = message.RecalledBy
+	return map[string]interface{}{"message": event}
+}
+
+// checkRecallPermission 检查用户是否可以撤回消息：
+// 群组管理员可以随时删除群内任意消息，发送者只能在撤回时限内撤回自己的消息
+func checkRecallPermission(userID string, message *models.Message) error {
+	if message.Type == models.MessageTypeGroup && message.SenderID != userID {
+		return checkGroupAdmin(userID, message.GroupID)
+	}
+	if message.SenderID != userID {
+		return newServiceError(http.StatusForbidden, "只能撤回自己发送的消息")
+	}
+
+	if time.Since(message.Timestamp) > config.AppConfig.Message.RecallWindow {
+		// 超过时限后群组管理员仍可删除自己的消息
+		if message.Type != models.MessageTypeGroup || checkGroupAdmin(userID, message.GroupID) != nil {
+			return newServiceError(http.StatusForbidden, "消息已超过可撤回时间")
+		}
+	}
+	return checkMessageAccess(userID, message)
+}
+
+// recallMessage 撤回消息，消息内容被清空，只保留占位记录
+func recallMessage(hub *websocket.Hub, userID, messageID string) (*models.Message, error) {
+	message, err := models.GetMessageByID(messageID)
+	if err != nil {
+		return nil, newServiceError(http.StatusNotFound, "消息不存在")
+	}
+	if message.Recalled() {
+		return nil, newServiceError(http.StatusBadRequest, "消息已撤回")
+	}
+
+	if err := checkRecallPermission(userID, message); err != nil {
+		return nil, err
+	}
+
+	recalled, err := models.RecallMessage(message.ID, userID)
+	if errors.Is(err, models.ErrMessageRecalled) {
+		return nil, newServiceError(http.StatusBadRequest, err.Error())
+	}
+	if err != nil {
+		return nil, newServiceError(http.StatusInternalServerError, "撤回消息失败")
+	}
+
+	// 撤回后的消息不再显示表情回应
+	if err := models.DeleteMessageReactions(recalled.ID); err != nil {
+		log.Printf("删除表情回应失败: %v", err)
+	}
+
+	// 编辑记录和尚未确认的推送中仍有原文，一并清除
+	if err := models.RedactMessageEdits(recalled.ID); err != nil {
+		log.Printf("清除消息编辑记录失败: %v", err)
+	}
+	if err := hub.DropRef(recalled.ID.Hex()); err != nil {
+		log.Printf("删除待确认事件失败: %v", err)
+	}
+
+	data := map[string]interface{}{"messageId": recalled.ID.Hex(), "recalledAt": recalled.RecalledAt}
+	publishMessageChange(hub, recalled, userID, models.ConversationEventMessageRecalled, eventTypeMessageRecalled, messageRecalledEvent(recalled), data)
+
+	return recalled, nil
+}
+
+// RecallMessage 撤回或删除消息
+func RecallMessage(c *gin.Context) {
+	userID := c.GetString("userId")
+
+	hub := c.MustGet("wsHub").(*websocket.Hub)
+
+	message, err := recallMessage(hub, userID, c.Param("messageId"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "消息已撤回",
+		"data":    message,
+	})
+}
+
+// wsRecallMessage 通过WebSocket撤回消息
+func wsRecallMessage(c *websocket.Client, payload json.RawMessage) (interface{}, error) {
+	var req RecallMessageRequest
+	if err := bindWSPayload(payload, &req); err != nil {
+		return nil, err
+	}
+
+	message, err := recallMessage(c.Hub, c.UserID, req.MessageID)
+	if err != nil {
+		return nil, wsError(err)
+	}
+
+	return gin.H{"message": message}, nil
+}
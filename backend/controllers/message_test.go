@@ -0,0 +1,20 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/yourusername/gin-vue-chat/models"
+)
+
+func TestCheckMessageAccessOutsider(t *testing.T) {
+	message := &models.Message{Type: models.MessageTypePrivate, SenderID: "alice", ReceiverID: "bob"}
+
+	// carol即使是双方的好友，也不能访问他们之间的私聊消息，不需要查询好友关系
+	err := checkMessageAccess("carol", message)
+	var se *serviceError
+	if !errors.As(err, &se) || se.status != http.StatusForbidden {
+		t.Fatalf("会话之外的用户返回 %v，期望403", err)
+	}
+}
@@ -0,0 +1,124 @@
+package controllers
+
+import (
+	"log"
+	"time"
+
+	"github.com/yourusername/gin-vue-chat/models"
+	"github.com/yourusername/gin-vue-chat/websocket"
+)
+
+// RegisterPresence 由WebSocket连接的建立和断开驱动用户在线状态。
+// 启动时删除本实例上次运行遗留的在线记录，运行期间定时刷新记录的心跳
+func RegisterPresence(hub *websocket.Hub) {
+	hub.OnPresence(func(userID string, online bool, at time.Time) {
+		updatePresence(hub, userID, online, at)
+	})
+
+	if err := models.ClearPresenceSessions(hub.ID()); err != nil {
+		log.Printf("清除遗留的在线记录失败: %v", err)
+	}
+	go heartbeatPresence(hub)
+}
+
+// heartbeatPresence 定时刷新本实例的在线记录，Hub关闭后停止。
+// 实例崩溃后记录不再刷新，过期后不再算作在线
+func heartbeatPresence(hub *websocket.Hub) {
+	ticker := time.NewTicker(models.PresenceHeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-hub.Done():
+			return
+		case <-ticker.C:
+			if err := models.TouchPresenceSessions(hub.ID()); err != nil {
+				log.Printf("刷新在线记录失败: %v", err)
+			}
+		}
+	}
+}
+
+// updatePresence 保存用户在线状态并推送给好友和群组成员。
+// 用户离开本实例时，只要仍连接着其他实例就不标记为离线
+func updatePresence(hub *websocket.Hub, userID string, online bool, at time.Time) {
+	status := "offline"
+	if online {
+		status = "online"
+		if err := models.AddPresenceSession(userID, hub.ID()); err != nil {
+			log.Printf("记录在线实例失败 (%s): %v", userID, err)
+		}
+	} else {
+		elsewhere, err := models.RemovePresenceSession(userID, hub.ID())
+		if err != nil {
+			log.Printf("删除在线实例失败 (%s): %v", userID, err)
+		}
+		if elsewhere {
+			return
+		}
+	}
+
+	updated, err := models.UpdateUserPresence(userID, status, at)
+	if err != nil {
+		log.Printf("更新在线状态失败 (%s): %v", userID, err)
+		return
+	}
+	if !updated {
+		// 已有更晚的状态变化，例如用户已重连到其他实例
+		return
+	}
+
+	wsMessage := map[string]interface{}{
+		"presence": map[string]interface{}{
+			"userId":     userID,
+			"status":     status,
+			"lastSeenAt": at,
+		},
+	}
+
+	// 在线状态是瞬时信息，不需要客户端确认
+	for _, recipientID := range presenceRecipients(userID) {
+		hub.Notify(recipientID, "presence", wsMessage)
+	}
+}
+
+// presenceRecipients 获取需要接收在线状态变化的用户：已接受的好友和所在群组的成员
+func presenceRecipients(userID string) []string {
+	seen := map[string]bool{userID: true}
+	var recipients []string
+	add := func(id string) {
+		if !seen[id] {
+			seen[id] = true
+			recipients = append(recipients, id)
+		}
+	}
+
+	friendships, err := models.GetFriendships(userID, "accepted")
+	if err != nil {
+		log.Printf("获取好友关系失败: %v", err)
+	}
+	for _, friendship := range friendships {
+		if friendship.UserID == userID {
+			add(friendship.FriendID)
+		} else {
+			add(friendship.UserID)
+		}
+	}
+
+	groups, err := models.GetUserGroups(userID)
+	if err != nil {
+		log.Printf("获取用户群组失败: %v", err)
+	}
+	for _, group := range groups {
+		members, err := models.GetGroupMembers(group.ID.Hex())
+		if err != nil {
+			log.Printf("获取群组成员失败: %v", err)
+			continue
+		}
+		for _, member := range members {
+			add(member.UserID)
+		}
+	}
+
+	return recipients
+}
@@ -0,0 +1,141 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yourusername/gin-vue-chat/config"
+	"github.com/yourusername/gin-vue-chat/models"
+	"github.com/yourusername/gin-vue-chat/websocket"
+)
+
+// 表情回应事件类型
+const eventTypeMessageReaction = "message_reaction"
+
+// 表情回应操作
+const (
+	reactionActionAdd    = "add"
+	reactionActionRemove = "remove"
+)
+
+// ReactionRequest 添加或取消表情回应请求
+type ReactionRequest struct {
+	MessageID string `json:"messageId"`
+	Emoji     string `json:"emoji" binding:"required,max=32"`
+}
+
+// reactToMessage 添加或取消表情回应，有修改时推送最新的回应汇总
+func reactToMessage(hub *websocket.Hub, userID, messageID, emoji, action string) ([]*models.ReactionSummary, error) {
+	message, err := models.GetMessageByID(messageID)
+	if err != nil {
+		return nil, newServiceError(http.StatusNotFound, "消息不存在")
+	}
+	if message.Recalled() {
+		return nil, newServiceError(http.StatusBadRequest, "消息已撤回")
+	}
+	if err := checkMessageAccess(userID, message); err != nil {
+		return nil, err
+	}
+
+	var changed bool
+	if action == reactionActionAdd {
+		changed, err = models.AddReaction(message.ID, userID, emoji, config.AppConfig.Message.MaxReactions)
+	} else {
+		changed, err = models.RemoveReaction(message.ID, userID, emoji)
+	}
+	if errors.Is(err, models.ErrTooManyReactions) {
+		return nil, newServiceError(http.StatusBadRequest, err.Error())
+	}
+	if err != nil {
+		return nil, newServiceError(http.StatusInternalServerError, "服务器错误")
+	}
+
+	reactions, err := models.GetMessageReactions(message.ID)
+	if err != nil {
+		return nil, newServiceError(http.StatusInternalServerError, "服务器错误")
+	}
+
+	// 重复添加或取消时没有变化，不推送
+	if changed {
+		pushReactionEvent(hub, message, map[string]interface{}{
+			"message":   messageRef(message),
+			"reaction":  map[string]interface{}{"emoji": emoji, "userId": userID, "action": action},
+			"reactions": reactions,
+		})
+	}
+
+	return reactions, nil
+}
+
+// pushReactionEvent 推送表情回应汇总。汇总是完整的，客户端直接替换，不依赖事件顺序，
+// 丢失后下次加载消息时也能拿到最新的汇总，因此作为临时事件推送，不进入待确认存储
+func pushReactionEvent(hub *websocket.Hub, message *models.Message, event map[string]interface{}) {
+	var err error
+	if message.Type == models.MessageTypeGroup {
+		err = hub.PublishToRoom(message.GroupID, eventTypeMessageReaction, event, "")
+	} else {
+		err = hub.NotifyUsers([]string{message.SenderID, message.ReceiverID}, eventTypeMessageReaction, event)
+	}
+	if err != nil {
+		log.Printf("表情回应推送失败: %v", err)
+	}
+}
+
+// AddReaction 添加表情回应
+func AddReaction(c *gin.Context) {
+	userID := c.GetString("userId")
+
+	var req ReactionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数无效"})
+		return
+	}
+
+	hub := c.MustGet("wsHub").(*websocket.Hub)
+
+	reactions, err := reactToMessage(hub, userID, c.Param("messageId"), req.Emoji, reactionActionAdd)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"reactions": reactions})
+}
+
+// RemoveReaction 取消表情回应
+func RemoveReaction(c *gin.Context) {
+	userID := c.GetString("userId")
+
+	hub := c.MustGet("wsHub").(*websocket.Hub)
+
+	reactions, err := reactToMessage(hub, userID, c.Param("messageId"), c.Param("emoji"), reactionActionRemove)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"reactions": reactions})
+}
+
+// wsReaction 通过WebSocket添加或取消表情回应
+func wsReaction(action string) websocket.HandlerFunc {
+	return func(c *websocket.Client, payload json.RawMessage) (interface{}, error) {
+		var req ReactionRequest
+		if err := bindWSPayload(payload, &req); err != nil {
+			return nil, err
+		}
+		if req.MessageID == "" {
+			return nil, websocket.NewError(http.StatusBadRequest, "请求参数无效")
+		}
+
+		reactions, err := reactToMessage(c.Hub, c.UserID, req.MessageID, req.Emoji, action)
+		if err != nil {
+			return nil, wsError(err)
+		}
+
+		return gin.H{"reactions": reactions}, nil
+	}
+}
@@ -0,0 +1,217 @@
+package controllers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yourusername/gin-vue-chat/models"
+	"github.com/yourusername/gin-vue-chat/websocket"
+)
+
+// 已读事件类型，私聊中作为已读回执推送给对方
+const eventTypeRead = "read"
+
+// MarkReadRequest 标记已读请求，会话中该消息及之前的消息都标记为已读
+type MarkReadRequest struct {
+	Type      string `json:"type" binding:"required,oneof=private group"`
+	TargetID  string `json:"targetId" binding:"required"` // 私聊时为对方用户ID，群聊时为群组ID
+	MessageID string `json:"messageId" binding:"required"`
+}
+
+// markRead 移动用户在会话中的已读位置，并通知会话中的其他人
+func markRead(hub *websocket.Hub, userID string, req *MarkReadRequest) (*models.ReadState, error) {
+	if err := checkConversationAccess(userID, req.Type, req.TargetID); err != nil {
+		return nil, err
+	}
+
+	message, err := models.GetMessageByID(req.MessageID)
+	if err != nil || !inConversation(message, req.Type, userID, req.TargetID) {
+		return nil, newServiceError(http.StatusNotFound, "消息不存在")
+	}
+
+	previous, err := models.GetReadState(userID, req.Type, req.TargetID)
+	if err != nil {
+		return nil, newServiceError(http.StatusInternalServerError, "标记已读失败")
+	}
+
+	moved, err := models.MarkRead(userID, req.Type, req.TargetID, message)
+	if err != nil {
+		return nil, newServiceError(http.StatusInternalServerError, "标记已读失败")
+	}
+
+	state, err := models.GetReadState(userID, req.Type, req.TargetID)
+	if err != nil || state == nil {
+		return nil, newServiceError(http.StatusInternalServerError, "标记已读失败")
+	}
+	if !moved {
+		return state, nil
+	}
+
+	// 已读状态可以随时从已读位置恢复，推送失败不需要重放
+	event := map[string]interface{}{"read": map[string]interface{}{
+		"type":      req.Type,
+		"userId":    userID,
+		"targetId":  req.TargetID,
+		"messageId": state.LastReadID.Hex(),
+		"cursor":    state.Cursor().String(),
+		// 已读位置最后移动的时间，不是每条消息各自的已读时间
+		"watermarkUpdatedAt": state.UpdatedAt,
+	}}
+	if req.Type == models.MessageTypeGroup {
+		// 只通知本次新读到的消息的发送者和自己的其他设备，不广播给整个群组
+		var after *models.MessageCursor
+		if previous != nil {
+			after = previous.Cursor()
+		}
+		recipients, err := models.GetGroupSendersBetween(req.TargetID, after, state.Cursor(), userID)
+		if err != nil {
+			log.Printf("获取已读通知对象失败: %v", err)
+		}
+		if err := hub.NotifyUsers(append(recipients, userID), eventTypeRead, event); err != nil {
+			log.Printf("已读状态推送失败: %v", err)
+		}
+	} else {
+		// 对方收到已读回执，自己的其他设备同步已读位置
+		hub.Notify(req.TargetID, eventTypeRead, event)
+		hub.Notify(userID, eventTypeRead, event)
+	}
+
+	return state, nil
+}
+
+// addReadCursors 在消息分页响应中加入自己的已读位置，私聊时还包括对方的已读位置
+func addReadCursors(response gin.H, conversationType, userID, targetID string) {
+	state, err := models.GetReadState(userID, conversationType, targetID)
+	if err != nil {
+		log.Printf("获取已读位置失败: %v", err)
+	} else if state != nil {
+		response["readCursor"] = state.Cursor().String()
+	}
+
+	if conversationType != models.MessageTypePrivate {
+		return
+	}
+	peerState, err := models.GetReadState(targetID, conversationType, userID)
+	if err != nil {
+		log.Printf("获取已读位置失败: %v", err)
+	} else if peerState != nil {
+		response["peerReadCursor"] = peerState.Cursor().String()
+	}
+}
+
+// MarkRead 标记会话已读
+func MarkRead(c *gin.Context) {
+	userID := c.GetString("userId")
+
+	var req MarkReadRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数无效"})
+		return
+	}
+
+	hub := c.MustGet("wsHub").(*websocket.Hub)
+
+	state, err := markRead(hub, userID, &req)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"messageId": state.LastReadID.Hex(),
+		"cursor":    state.Cursor().String(),
+	})
+}
+
+// GetMessageReads 获取消息的已读情况：私聊返回对方是否已读，群聊返回已读成员列表
+func GetMessageReads(c *gin.Context) {
+	userID := c.GetString("userId")
+
+	message, err := models.GetMessageByID(c.Param("messageId"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "消息不存在"})
+		return
+	}
+	if err := checkMessageAccess(userID, message); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	if message.Type == models.MessageTypePrivate {
+		state, err := models.GetReadState(message.ReceiverID, models.MessageTypePrivate, message.SenderID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "服务器错误"})
+			return
+		}
+
+		response := gin.H{"read": state != nil && state.HasRead(message)}
+		if state != nil && state.HasRead(message) {
+			response["watermarkUpdatedAt"] = state.UpdatedAt
+		}
+		c.JSON(http.StatusOK, response)
+		return
+	}
+
+	members, err := models.GetGroupMembers(message.GroupID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "服务器错误"})
+		return
+	}
+	states, err := models.GetGroupReadStates(message.GroupID, message)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "服务器错误"})
+		return
+	}
+
+	// 只统计仍在群组中的成员，不包括发送者自己
+	isMember := make(map[string]bool, len(members))
+	for _, member := range members {
+		isMember[member.UserID] = true
+	}
+	readers := make([]*models.ReadState, 0, len(states))
+	readerIDs := make([]string, 0, len(states))
+	for _, state := range states {
+		if !isMember[state.UserID] || state.UserID == message.SenderID {
+			continue
+		}
+		readers = append(readers, state)
+		readerIDs = append(readerIDs, state.UserID)
+	}
+
+	users := senderInfos(readerIDs)
+	readBy := make([]gin.H, 0, len(readers))
+	for _, state := range readers {
+		readBy = append(readBy, gin.H{
+			"user":               users[state.UserID],
+			"watermarkUpdatedAt": state.UpdatedAt,
+		})
+	}
+
+	total := len(members)
+	if isMember[message.SenderID] {
+		total--
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"readCount":   len(readBy),
+		"unreadCount": total - len(readBy),
+		"readBy":      readBy,
+	})
+}
+
+// wsMarkRead 通过WebSocket标记会话已读
+func wsMarkRead(c *websocket.Client, payload json.RawMessage) (interface{}, error) {
+	var req MarkReadRequest
+	if err := bindWSPayload(payload, &req); err != nil {
+		return nil, err
+	}
+
+	state, err := markRead(c.Hub, c.UserID, &req)
+	if err != nil {
+		return nil, wsError(err)
+	}
+
+	return gin.H{"messageId": state.LastReadID.Hex(), "cursor": state.Cursor().String()}, nil
+}
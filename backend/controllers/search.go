@@ -0,0 +1,147 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yourusername/gin-vue-chat/models"
+)
+
+// parseSearchTime 解析搜索的时间范围参数，支持RFC3339和日期格式。
+// 时间范围不包含结束时间，endOfDay为true时只有日期的参数表示到当天结束，
+// 即第二天零点
+func parseSearchTime(value string, endOfDay bool) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return &t, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return nil, newServiceError(http.StatusBadRequest, "无效的时间: "+value)
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1)
+	}
+	return &t, nil
+}
+
+// searchScope 返回用户可以搜索的会话，规则与获取历史消息一致：
+// 私聊需要仍是好友，群聊需要仍是群组成员。指定会话时只搜索该会话
+func searchScope(userID, conversationType, targetID string) ([]string, []string, error) {
+	if targetID != "" {
+		if conversationType != models.MessageTypePrivate && conversationType != models.MessageTypeGroup {
+			return nil, nil, newServiceError(http.StatusBadRequest, "指定会话时必须指定会话类型")
+		}
+		if err := checkConversationAccess(userID, conversationType, targetID); err != nil {
+			return nil, nil, err
+		}
+		if conversationType == models.MessageTypeGroup {
+			return []string{}, []string{targetID}, nil
+		}
+		return []string{targetID}, []string{}, nil
+	}
+
+	friendIDs := []string{}
+	if conversationType != models.MessageTypeGroup {
+		friendships, err := models.GetFriendships(userID, "accepted")
+		if err != nil {
+			return nil, nil, newServiceError(http.StatusInternalServerError, "服务器错误")
+		}
+		for _, friendship := range friendships {
+			if friendship.UserID == userID {
+				friendIDs = append(friendIDs, friendship.FriendID)
+			} else {
+				friendIDs = append(friendIDs, friendship.UserID)
+			}
+		}
+	}
+
+	groupIDs := []string{}
+	if conversationType != models.MessageTypePrivate {
+		ids, err := userGroupIDs(userID)
+		if err != nil {
+			return nil, nil, newServiceError(http.StatusInternalServerError, "服务器错误")
+		}
+		groupIDs = ids
+	}
+
+	return friendIDs, groupIDs, nil
+}
+
+// SearchMessages 搜索消息。q支持空格分隔的关键词和双引号括起的短语，
+// 可按会话(type、targetId)、发送者(senderId)和时间范围(from、to)过滤
+func SearchMessages(c *gin.Context) {
+	userID := c.GetString("userId")
+
+	terms := models.ParseSearchTerms(strings.TrimSpace(c.Query("q")))
+	if terms.Empty() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请输入搜索内容"})
+		return
+	}
+
+	query := &models.MessageSearchQuery{
+		UserID:   userID,
+		Terms:    terms,
+		SenderID: c.Query("senderId"),
+		Limit:    models.DefaultMessagePageSize,
+	}
+	if limitStr := c.Query("limit"); limitStr != "" {
+		if l, err := strconv.ParseInt(limitStr, 10, 64); err == nil && l > 0 {
+			query.Limit = l
+		}
+	}
+	if query.Limit > models.MaxMessagePageSize {
+		query.Limit = models.MaxMessagePageSize
+	}
+
+	var err error
+	if query.From, err = parseSearchTime(c.Query("from"), false); err != nil {
+		respondError(c, err)
+		return
+	}
+	if query.To, err = parseSearchTime(c.Query("to"), true); err != nil {
+		respondError(c, err)
+		return
+	}
+	if before := c.Query("before"); before != "" {
+		if query.Before, err = models.ParseMessageCursor(before); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	query.FriendIDs, query.GroupIDs, err = searchScope(userID, c.Query("type"), c.Query("targetId"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	page, err := models.SearchMessages(query)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "搜索消息失败"})
+		return
+	}
+
+	results := make([]gin.H, 0, len(page.Messages))
+	for _, message := range page.Messages {
+		results = append(results, gin.H{
+			"message": message,
+			"snippet": models.Highlight(message.Content, terms),
+		})
+	}
+
+	response := gin.H{
+		"results": results,
+		"hasMore": page.HasMore,
+	}
+	if page.HasMore {
+		// 结果按时间倒序，下一页从本页最早的消息之前开始
+		response["nextCursor"] = models.NewMessageCursor(page.Messages[len(page.Messages)-1]).String()
+	}
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,42 @@
+package controllers
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSearchTime(t *testing.T) {
+	day := time.Date(2024, 3, 8, 0, 0, 0, 0, time.Local)
+	exact := time.Date(2024, 3, 8, 15, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		value    string
+		endOfDay bool
+		want     time.Time
+	}{
+		{"开始日期为当天零点", "2024-03-08", false, day},
+		{"结束日期包含当天整天", "2024-03-08", true, day.AddDate(0, 0, 1)},
+		{"RFC3339开始时间", "2024-03-08T15:04:05Z", false, exact},
+		{"RFC3339结束时间不调整", "2024-03-08T15:04:05Z", true, exact},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseSearchTime(tt.value, tt.endOfDay)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got == nil || !got.Equal(tt.want) {
+				t.Fatalf("parseSearchTime(%q, %v) = %v，期望 %v", tt.value, tt.endOfDay, got, tt.want)
+			}
+		})
+	}
+
+	if got, err := parseSearchTime("", true); got != nil || err != nil {
+		t.Fatalf("空参数返回 %v, %v，期望不限制", got, err)
+	}
+	if _, err := parseSearchTime("2024/03/08", false); err == nil {
+		t.Fatal("无效的时间没有返回错误")
+	}
+}
@@ -0,0 +1,235 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yourusername/gin-vue-chat/models"
+	"github.com/yourusername/gin-vue-chat/websocket"
+)
+
+const (
+	// 每个会话单次同步返回的最大条数
+	defaultSyncLimit = 200
+	maxSyncLimit     = 1000
+)
+
+// SyncCursor 客户端在某个会话中最后看到的位置
+type SyncCursor struct {
+	Type   string `json:"type" binding:"required,oneof=private group"`
+	ID     string `json:"id" binding:"required"` // 私聊时为对方用户ID，群聊时为群组ID
+	Cursor string `json:"cursor"`                // 最后看到的消息或状态变化的游标，为空时从头同步
+}
+
+// SyncRequest 增量同步请求
+type SyncRequest struct {
+	Cursors []SyncCursor `json:"cursors" binding:"dive"`
+	// 未在cursors中列出的会话从该游标开始同步，为空时不返回这些会话
+	Since string `json:"since"`
+	Limit int64  `json:"limit"`
+}
+
+// SyncConversation 单个会话的同步结果
+type SyncConversation struct {
+	Type     string                      `json:"type"`
+	ID       string                      `json:"id"`
+	Messages []*models.Message           `json:"messages"`
+	Events   []*models.ConversationEvent `json:"events"`
+	Cursor   string                      `json:"cursor"`           // 下次同步使用的游标
+	HasMore  bool                        `json:"hasMore"`          // 为true时需要用新游标继续同步
+	Error    string                      `json:"error,omitempty"`  // 无法同步该会话的原因，例如已不是好友或群组成员
+	Status   int                         `json:"status,omitempty"` // 错误对应的HTTP状态码
+}
+
+// parseCursor 解析"毫秒时间戳_ID"格式的游标，空字符串表示从头开始，返回nil。
+// 消息和状态变化在不同集合中，ID由不同实例生成，只能按(时间, ID)合并排序
+func parseCursor(cursor string) (*models.MessageCursor, error) {
+	if cursor == "" {
+		return nil, nil
+	}
+	return models.ParseMessageCursor(cursor)
+}
+
+// syncConversations 返回用户各会话游标之后的新消息和状态变化
+func syncConversations(userID string, req *SyncRequest) ([]*SyncConversation, error) {
+	limit := req.Limit
+	if limit <= 0 {
+		limit = defaultSyncLimit
+	}
+	if limit > maxSyncLimit {
+		limit = maxSyncLimit
+	}
+
+	cursors := make([]SyncCursor, 0, len(req.Cursors))
+	listed := make(map[string]bool)
+	for _, cursor := range req.Cursors {
+		if _, err := parseCursor(cursor.Cursor); err != nil {
+			return nil, newServiceError(http.StatusBadRequest, "无效的游标: "+cursor.Cursor)
+		}
+		cursors = append(cursors, cursor)
+		listed[cursor.Type+":"+cursor.ID] = true
+	}
+
+	// 补充客户端尚未知道的会话
+	if req.Since != "" {
+		if _, err := parseCursor(req.Since); err != nil {
+			return nil, newServiceError(http.StatusBadRequest, "无效的游标: "+req.Since)
+		}
+
+		friendships, err := models.GetFriendships(userID, "accepted")
+		if err != nil {
+			return nil, newServiceError(http.StatusInternalServerError, "服务器错误")
+		}
+		for _, friendship := range friendships {
+			friendID := friendship.FriendID
+			if friendship.FriendID == userID {
+				friendID = friendship.UserID
+			}
+			if !listed[models.MessageTypePrivate+":"+friendID] {
+				cursors = append(cursors, SyncCursor{Type: models.MessageTypePrivate, ID: friendID, Cursor: req.Since})
+			}
+		}
+
+		groups, err := models.GetUserGroups(userID)
+		if err != nil {
+			return nil, newServiceError(http.StatusInternalServerError, "服务器错误")
+		}
+		for _, group := range groups {
+			if !listed[models.MessageTypeGroup+":"+group.ID.Hex()] {
+				cursors = append(cursors, SyncCursor{Type: models.MessageTypeGroup, ID: group.ID.Hex(), Cursor: req.Since})
+			}
+		}
+	}
+
+	conversations := make([]*SyncConversation, 0, len(cursors))
+	for _, cursor := range cursors {
+		conversations = append(conversations, syncConversation(userID, cursor, limit))
+	}
+
+	return conversations, nil
+}
+
+// syncConversation 同步单个会话，权限检查与获取历史消息一致
+func syncConversation(userID string, cursor SyncCursor, limit int64) *SyncConversation {
+	result := &SyncConversation{
+		Type:     cursor.Type,
+		ID:       cursor.ID,
+		Messages: []*models.Message{},
+		Events:   []*models.ConversationEvent{},
+		Cursor:   cursor.Cursor,
+	}
+	after, _ := parseCursor(cursor.Cursor)
+
+	var err error
+	if cursor.Type == models.MessageTypePrivate {
+		err = checkFriendship(userID, cursor.ID)
+		if err == nil {
+			result.Messages, err = models.GetPrivateMessagesAfter(userID, cursor.ID, after, limit+1)
+		}
+		if err == nil {
+			result.Events, err = models.GetPrivateEventsAfter(userID, cursor.ID, after, limit+1)
+		}
+	} else {
+		err = checkGroupMembership(userID, cursor.ID)
+		if err == nil {
+			result.Messages, err = models.GetGroupMessagesAfter(cursor.ID, after, limit+1)
+			if err == nil {
+				result.Events, err = models.GetGroupEventsAfter(cursor.ID, after, limit+1)
+			}
+		} else if events := groupExitEvents(userID, cursor.ID, after, limit+1); len(events) > 0 {
+			// 已离开的成员仍需同步自己被移除或群组解散的事件，之后才返回无权访问
+			result.Events, err = events, nil
+		}
+	}
+
+	if err != nil {
+		var se *serviceError
+		if !errors.As(err, &se) {
+			se = &serviceError{status: http.StatusInternalServerError, message: "同步失败"}
+		}
+		result.Error = se.message
+		result.Status = se.status
+		return result
+	}
+
+	trimSyncResult(result, limit)
+	return result
+}
+
+// groupExitEvents 获取曾经的群组成员尚未同步的终止事件，查询失败时返回空
+func groupExitEvents(userID, groupID string, after *models.MessageCursor, limit int64) []*models.ConversationEvent {
+	if wasMember, err := models.WasGroupMember(groupID, userID); err != nil || !wasMember {
+		return nil
+	}
+
+	events, err := models.GetGroupExitEventsAfter(groupID, userID, after, limit)
+	if err != nil {
+		log.Printf("获取群组终止事件失败 (%s): %v", groupID, err)
+		return nil
+	}
+
+	return events
+}
+
+// trimSyncResult 合并消息和状态变化后截取前limit条，并计算新的游标
+func trimSyncResult(result *SyncConversation, limit int64) {
+	// 两个列表都按(时间, ID)升序，找出合并后第limit条的位置作为新游标
+	var last *models.MessageCursor
+	i, j := 0, 0
+	for n := int64(0); n < limit && (i < len(result.Messages) || j < len(result.Events)); n++ {
+		if j < len(result.Events) {
+			event := result.Events[j].Cursor()
+			if i >= len(result.Messages) || event.Before(models.NewMessageCursor(result.Messages[i])) {
+				last = event
+				j++
+				continue
+			}
+		}
+		last = models.NewMessageCursor(result.Messages[i])
+		i++
+	}
+
+	result.HasMore = i < len(result.Messages) || j < len(result.Events)
+	result.Messages = result.Messages[:i]
+	result.Events = result.Events[:j]
+	if last != nil {
+		result.Cursor = last.String()
+	}
+}
+
+// Sync 增量同步：返回各会话游标之后的新消息和状态变化
+func Sync(c *gin.Context) {
+	userID := c.GetString("userId")
+
+	var req SyncRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数无效"})
+		return
+	}
+
+	conversations, err := syncConversations(userID, &req)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"conversations": conversations})
+}
+
+// wsSync 通过WebSocket增量同步
+func wsSync(c *websocket.Client, payload json.RawMessage) (interface{}, error) {
+	var req SyncRequest
+	if err := bindWSPayload(payload, &req); err != nil {
+		return nil, err
+	}
+
+	conversations, err := syncConversations(c.UserID, &req)
+	if err != nil {
+		return nil, wsError(err)
+	}
+
+	return gin.H{"conversations": conversations}, nil
+}
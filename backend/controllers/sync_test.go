@@ -0,0 +1,141 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/yourusername/gin-vue-chat/config"
+	"github.com/yourusername/gin-vue-chat/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// setupTestMongo 连接MONGO_TEST_URI指定的MongoDB并使用独立的临时数据库，测试结束后删除
+func setupTestMongo(t *testing.T) {
+	t.Helper()
+
+	uri := os.Getenv("MONGO_TEST_URI")
+	if uri == "" {
+		t.Skip("未设置MONGO_TEST_URI，跳过MongoDB集成测试")
+	}
+
+	config.InitConfig()
+	config.AppConfig.MongoDB.URI = uri
+	config.AppConfig.MongoDB.Database = fmt.Sprintf("chat_test_%d", time.Now().UnixNano())
+	models.InitMongoDB()
+
+	t.Cleanup(func() {
+		ctx := context.Background()
+		models.MongoDatabase.Drop(ctx)
+		models.CloseMongoDB(ctx)
+	})
+}
+
+// createTestUser 创建测试用户
+func createTestUser(t *testing.T, username string) string {
+	t.Helper()
+
+	user, err := models.CreateUser(username, "password", username+"@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user.ID.Hex()
+}
+
+func TestSyncGroupExitEvents(t *testing.T) {
+	setupTestMongo(t)
+
+	owner := createTestUser(t, "owner")
+	alice := createTestUser(t, "alice")
+	bob := createTestUser(t, "bob")
+
+	group, err := models.CreateGroup("test", "", "", owner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	groupID := group.ID.Hex()
+	for _, userID := range []string{alice, bob} {
+		if _, err := models.AddGroupMember(groupID, userID, "member"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 移除alice，与RemoveGroupMember接口的记录方式相同
+	if err := models.RemoveGroupMember(groupID, alice); err != nil {
+		t.Fatal(err)
+	}
+	if err := models.RecordGroupEvent(groupID, models.ConversationEventMemberRemoved, owner, map[string]interface{}{"userId": alice}); err != nil {
+		t.Fatal(err)
+	}
+
+	// alice已不是成员，但能同步到自己被移除的事件
+	cursor := SyncCursor{Type: models.MessageTypeGroup, ID: groupID}
+	result := syncConversation(alice, cursor, defaultSyncLimit)
+	if result.Error != "" {
+		t.Fatalf("同步被移除事件失败: %s", result.Error)
+	}
+	if len(result.Events) != 1 || result.Events[0].Event != models.ConversationEventMemberRemoved {
+		t.Fatalf("期望一个member_removed事件，得到 %+v", result.Events)
+	}
+
+	// 同步过终止事件后无权再访问
+	cursor.Cursor = result.Cursor
+	if result = syncConversation(alice, cursor, defaultSyncLimit); result.Status != http.StatusForbidden {
+		t.Fatalf("期望403，得到 %d %s", result.Status, result.Error)
+	}
+
+	// 解散群组后剩余成员能同步到解散事件，但看不到其他成员被移除的事件
+	for _, userID := range []string{owner, bob} {
+		if err := models.RemoveGroupMember(groupID, userID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := models.DeleteGroup(groupID); err != nil {
+		t.Fatal(err)
+	}
+	if err := models.RecordGroupEvent(groupID, models.ConversationEventGroupDeleted, owner, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	result = syncConversation(bob, SyncCursor{Type: models.MessageTypeGroup, ID: groupID}, defaultSyncLimit)
+	if result.Error != "" {
+		t.Fatalf("同步解散事件失败: %s", result.Error)
+	}
+	if len(result.Events) != 1 || result.Events[0].Event != models.ConversationEventGroupDeleted {
+		t.Fatalf("期望一个group_deleted事件，得到 %+v", result.Events)
+	}
+
+	// 从未加入过群组的用户仍然无权访问
+	stranger := createTestUser(t, "stranger")
+	if result = syncConversation(stranger, SyncCursor{Type: models.MessageTypeGroup, ID: groupID}, defaultSyncLimit); result.Status != http.StatusNotFound {
+		t.Fatalf("期望404，得到 %d %s", result.Status, result.Error)
+	}
+}
+
+func TestTrimSyncResultOrdersByTime(t *testing.T) {
+	base := time.UnixMilli(1709910245123)
+
+	// 状态变化的ID更小但时间更晚，例如由时钟稍慢的实例生成，合并时应排在消息之后
+	var messageID, eventID primitive.ObjectID
+	messageID[11] = 2
+	eventID[11] = 1
+	message := &models.Message{ID: messageID, Timestamp: base}
+	event := &models.ConversationEvent{ID: eventID, CreatedAt: base.Add(time.Millisecond)}
+
+	result := &SyncConversation{
+		Messages: []*models.Message{message},
+		Events:   []*models.ConversationEvent{event},
+	}
+	trimSyncResult(result, 1)
+
+	if len(result.Messages) != 1 || len(result.Events) != 0 || !result.HasMore {
+		t.Fatalf("期望只返回消息且还有更多，得到 %d 条消息 %d 条状态变化 hasMore=%v",
+			len(result.Messages), len(result.Events), result.HasMore)
+	}
+	if want := models.NewMessageCursor(message).String(); result.Cursor != want {
+		t.Fatalf("游标 %s，期望 %s", result.Cursor, want)
+	}
+}
@@ -0,0 +1,137 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yourusername/gin-vue-chat/models"
+	"github.com/yourusername/gin-vue-chat/websocket"
+)
+
+// 话题回复事件类型，推送给话题参与者
+const eventTypeThreadReply = "thread_reply"
+
+// attachReplyTo 为新消息填充被回复消息的摘要，被回复的消息必须在同一会话中
+func attachReplyTo(message *models.Message, replyToID string) error {
+	if replyToID == "" {
+		return nil
+	}
+
+	quoted, err := models.GetMessageByID(replyToID)
+	if err != nil {
+		return newServiceError(http.StatusNotFound, "回复的消息不存在")
+	}
+
+	targetID := message.ReceiverID
+	if message.Type == models.MessageTypeGroup {
+		targetID = message.GroupID
+	}
+	if !inConversation(quoted, message.Type, message.SenderID, targetID) {
+		return newServiceError(http.StatusBadRequest, "回复的消息不在该会话中")
+	}
+	if quoted.Recalled() {
+		return newServiceError(http.StatusBadRequest, "回复的消息已撤回")
+	}
+
+	message.ReplyTo = models.NewMessageQuote(quoted)
+	return nil
+}
+
+// loadThreadRoot 获取话题根消息，根消息必须是该群组中不属于其他话题的消息
+func loadThreadRoot(threadID, groupID string) (*models.Message, error) {
+	root, err := models.GetMessageByID(threadID)
+	if err != nil || root.Type != models.MessageTypeGroup || root.GroupID != groupID {
+		return nil, newServiceError(http.StatusNotFound, "话题不存在")
+	}
+	if root.ThreadID != "" {
+		return nil, newServiceError(http.StatusBadRequest, "不能在话题回复下创建话题")
+	}
+	if root.Recalled() {
+		return nil, newServiceError(http.StatusBadRequest, "话题的根消息已撤回")
+	}
+	return root, nil
+}
+
+// notifyThreadReply 更新话题统计，并通知话题中仍是群组成员的其他参与者有新回复。
+// 群组成员同时通过群聊消息事件收到回复，客户端根据threadId更新话题
+func notifyThreadReply(hub *websocket.Hub, root, reply *models.Message) {
+	members, err := models.GetGroupMembers(root.GroupID)
+	if err != nil {
+		log.Printf("获取群组成员失败: %v", err)
+		return
+	}
+	isMember := make(map[string]bool, len(members))
+	for _, member := range members {
+		isMember[member.UserID] = true
+	}
+
+	// 根消息的发送者已离开群组时不再加入参与者
+	participants := []string{reply.SenderID}
+	if isMember[root.SenderID] {
+		participants = append(participants, root.SenderID)
+	}
+	root, err = models.AddThreadReply(root.ID, participants, reply.Timestamp)
+	if err != nil {
+		log.Printf("更新话题统计失败: %v", err)
+		return
+	}
+
+	event := groupMessageEvent(reply)
+	event["thread"] = map[string]interface{}{
+		"id":           root.ID.Hex(),
+		"replyCount":   root.Thread.ReplyCount,
+		"participants": root.Thread.Participants,
+		"lastReplyAt":  root.Thread.LastReplyAt,
+	}
+
+	// 已离开或被移除的参与者不再收到回复
+	recipients := make([]string, 0, len(root.Thread.Participants))
+	for _, participant := range root.Thread.Participants {
+		if participant != reply.SenderID && isMember[participant] {
+			recipients = append(recipients, participant)
+		}
+	}
+	if err := hub.DeliverRef(reply.ID.Hex(), recipients, eventTypeThreadReply, event); err != nil {
+		log.Printf("话题回复推送失败: %v", err)
+	}
+}
+
+// GetThread 获取话题的根消息和回复
+func GetThread(c *gin.Context) {
+	userID := c.GetString("userId")
+
+	root, err := models.GetMessageByID(c.Param("messageId"))
+	if err != nil || root.Type != models.MessageTypeGroup || root.ThreadID != "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "话题不存在"})
+		return
+	}
+
+	// 检查用户是否是群组成员
+	if err := checkGroupMembership(userID, root.GroupID); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	// 获取分页参数
+	query, err := parseMessagePage(c)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	page, err := models.GetThreadMessages(root.ID.Hex(), query)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取消息失败"})
+		return
+	}
+
+	if root.Reactions, err = models.GetMessageReactions(root.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取消息失败"})
+		return
+	}
+
+	response := messagePageResponse(page)
+	response["root"] = root
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,75 @@
+package controllers
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/yourusername/gin-vue-chat/models"
+	"github.com/yourusername/gin-vue-chat/websocket"
+)
+
+// 输入状态事件类型，只推送给在线用户，不保存也不进入待确认存储
+const typingEventType = "typing"
+
+const (
+	// 同一会话同一状态的输入事件的最小间隔
+	typingInterval = 2 * time.Second
+
+	// 接收方在没有新事件时清除输入状态的时间，客户端应在此之前重复发送
+	typingTTL = 5 * time.Second
+)
+
+// TypingRequest 输入状态请求
+type TypingRequest struct {
+	Type     string `json:"type" binding:"required,oneof=private group"`
+	TargetID string `json:"targetId" binding:"required"` // 私聊为对方用户ID，群聊为群组ID
+	Typing   bool   `json:"typing"`                      // true表示正在输入，false表示停止输入
+}
+
+// wsTyping 转发输入状态，私聊只发给对方，群聊只发给在线的其他成员
+func wsTyping(c *websocket.Client, payload json.RawMessage) (interface{}, error) {
+	var req TypingRequest
+	if err := bindWSPayload(payload, &req); err != nil {
+		return nil, err
+	}
+
+	// 超过频率的事件直接丢弃，接收方依靠过期时间保持状态
+	key := typingEventType + ":" + req.Type + ":" + req.TargetID
+	if req.Typing {
+		key += ":start"
+	} else {
+		key += ":stop"
+	}
+	if !c.Allow(key, typingInterval) {
+		return nil, nil
+	}
+
+	event := map[string]interface{}{
+		"type":   req.Type,
+		"userId": c.UserID,
+		"typing": req.Typing,
+		"ttl":    typingTTL.Milliseconds(),
+	}
+
+	if req.Type == models.MessageTypePrivate {
+		if err := checkFriendship(c.UserID, req.TargetID); err != nil {
+			return nil, wsError(err)
+		}
+
+		// 接收方看到的会话是发送方
+		event["conversationId"] = c.UserID
+		c.Hub.Notify(req.TargetID, typingEventType, event)
+		return nil, nil
+	}
+
+	if err := checkGroupMembership(c.UserID, req.TargetID); err != nil {
+		return nil, wsError(err)
+	}
+
+	event["conversationId"] = req.TargetID
+	if err := c.Hub.PublishToRoom(req.TargetID, typingEventType, event, c.UserID); err != nil {
+		log.Printf("输入状态推送失败: %v", err)
+	}
+	return nil, nil
+}
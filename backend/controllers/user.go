@@ -14,7 +14,6 @@ import (
 type UpdateProfileRequest struct {
 	Email  string `json:"email" binding:"omitempty,email"`
 	Avatar string `json:"avatar"`
-	Status string `json:"status" binding:"omitempty,oneof=online offline away"`
 }
 
 // ChangePasswordRequest 修改密码请求
@@ -60,7 +59,8 @@ func UpdateUserProfile(c *gin.Context) {
 		return
 	}
 
-	// 更新字段
+	// 更新字段，在线状态由WebSocket连接维护，不能通过资料修改
+	fields := bson.M{}
 	if req.Email != "" && req.Email != user.Email {
 		// 检查邮箱是否已被其他用户使用
 		collection := models.MongoDatabase.Collection("users")
@@ -77,17 +77,15 @@ func UpdateUserProfile(c *gin.Context) {
 		}
 
 		user.Email = req.Email
+		fields["email"] = req.Email
 	}
 
 	if req.Avatar != "" {
 		user.Avatar = req.Avatar
+		fields["avatar"] = req.Avatar
 	}
 
-	if req.Status != "" {
-		user.Status = req.Status
-	}
-
-	err = models.UpdateUser(user)
+	err = models.UpdateUser(user.ID, fields)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新用户资料失败"})
 		return
@@ -135,8 +133,7 @@ func ChangePassword(c *gin.Context) {
 	}
 
 	// 更新密码
-	user.Password = string(hashedPassword)
-	err = models.UpdateUser(user)
+	err = models.UpdateUser(user.ID, bson.M{"password": string(hashedPassword)})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新密码失败"})
 		return
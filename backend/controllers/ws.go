@@ -0,0 +1,156 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/yourusername/gin-vue-chat/models"
+	"github.com/yourusername/gin-vue-chat/websocket"
+)
+
+// WebSocket入站消息类型
+const (
+	wsTypePrivateMessage = "private_message" // 发送私聊消息
+	wsTypeGroupMessage   = "group_message"   // 发送群聊消息
+	wsTypeSync           = "sync"            // 增量同步
+	wsTypeCallStart      = "call_start"      // 发起通话
+	wsTypeCallAccept     = "call_accept"     // 接听通话
+	wsTypeCallReject     = "call_reject"     // 拒绝来电
+	wsTypeCallEnd        = "call_end"        // 挂断通话
+	wsTypeCallSignal     = "call_signal"     // 转发WebRTC信令
+	wsTypeTyping         = "typing"          // 输入状态
+	wsTypeEditMessage    = "edit_message"    // 编辑消息
+	wsTypeRecallMessage  = "recall_message"  // 撤回消息
+	wsTypeReactionAdd    = "reaction_add"    // 添加表情回应
+	wsTypeReactionRemove = "reaction_remove" // 取消表情回应
+	wsTypeMarkRead       = "mark_read"       // 标记已读
+)
+
+// RegisterWSHandlers 注册WebSocket入站消息处理器
+func RegisterWSHandlers(hub *websocket.Hub) {
+	hub.Handle(wsTypePrivateMessage, wsSendPrivateMessage)
+	hub.Handle(wsTypeGroupMessage, wsSendGroupMessage)
+	hub.Handle(wsTypeSync, wsSync)
+	hub.Handle(wsTypeCallStart, wsStartCall)
+	hub.Handle(wsTypeCallAccept, wsCallAction(acceptCall))
+	hub.Handle(wsTypeCallReject, wsCallAction(rejectCall))
+	hub.Handle(wsTypeCallEnd, wsCallAction(endCall))
+	hub.Handle(wsTypeCallSignal, wsCallSignal)
+	hub.Handle(wsTypeTyping, wsTyping)
+	hub.Handle(wsTypeEditMessage, wsEditMessage)
+	hub.Handle(wsTypeRecallMessage, wsRecallMessage)
+	hub.Handle(wsTypeReactionAdd, wsReaction(reactionActionAdd))
+	hub.Handle(wsTypeReactionRemove, wsReaction(reactionActionRemove))
+	hub.Handle(wsTypeMarkRead, wsMarkRead)
+}
+
+// RegisterRooms 连接建立时为客户端订阅用户所在的群组
+func RegisterRooms(hub *websocket.Hub) {
+	hub.SetRoomLoader(userGroupRooms)
+}
+
+// groupMessagesRoom 群组新消息的房间。群组房间（即群组ID）包括所有成员，
+// 用于输入状态和已发送消息的变化；新消息只推送到消息房间，设置了免打扰的成员不订阅
+func groupMessagesRoom(groupID string) string {
+	return groupID + ":messages"
+}
+
+// userGroupIDs 获取用户所在群组的ID列表
+func userGroupIDs(userID string) ([]string, error) {
+	groups, err := models.GetUserGroups(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	groupIDs := make([]string, 0, len(groups))
+	for _, group := range groups {
+		groupIDs = append(groupIDs, group.ID.Hex())
+	}
+	return groupIDs, nil
+}
+
+// userGroupRooms 获取用户需要订阅的群组房间，未设置免打扰的群组同时订阅消息房间
+func userGroupRooms(userID string) ([]string, error) {
+	groupIDs, err := userGroupIDs(userID)
+	if err != nil {
+		return nil, err
+	}
+	muted, err := models.GetMutedTargets(userID, models.MessageTypeGroup)
+	if err != nil {
+		return nil, err
+	}
+
+	rooms := make([]string, 0, 2*len(groupIDs))
+	for _, groupID := range groupIDs {
+		rooms = append(rooms, groupID)
+		if !muted[groupID] {
+			rooms = append(rooms, groupMessagesRoom(groupID))
+		}
+	}
+	return rooms, nil
+}
+
+// joinGroupRooms 用户加入群组后订阅群组房间和消息房间
+func joinGroupRooms(hub *websocket.Hub, userID, groupID string) {
+	hub.JoinRoom(userID, groupID)
+	hub.JoinRoom(userID, groupMessagesRoom(groupID))
+}
+
+// leaveGroupRooms 用户离开群组后取消订阅群组房间和消息房间
+func leaveGroupRooms(hub *websocket.Hub, userID, groupID string) {
+	hub.LeaveRoom(userID, groupID)
+	hub.LeaveRoom(userID, groupMessagesRoom(groupID))
+}
+
+// bindWSPayload 解析并校验WebSocket消息内容，校验规则与REST请求一致
+func bindWSPayload(payload json.RawMessage, obj interface{}) error {
+	if err := json.Unmarshal(payload, obj); err != nil {
+		return websocket.NewError(http.StatusBadRequest, "请求参数无效")
+	}
+	if err := binding.Validator.ValidateStruct(obj); err != nil {
+		return websocket.NewError(http.StatusBadRequest, "请求参数无效")
+	}
+	return nil
+}
+
+// wsError 将业务错误转换为WebSocket错误帧
+func wsError(err error) error {
+	var se *serviceError
+	if errors.As(err, &se) {
+		return websocket.NewError(se.status, se.message)
+	}
+	return err
+}
+
+// wsSendPrivateMessage 通过WebSocket发送私聊消息
+func wsSendPrivateMessage(c *websocket.Client, payload json.RawMessage) (interface{}, error) {
+	var req SendPrivateMessageRequest
+	if err := bindWSPayload(payload, &req); err != nil {
+		return nil, err
+	}
+
+	message, err := sendPrivateMessage(c.Hub, c.UserID, &req)
+	if err != nil {
+		return nil, wsError(err)
+	}
+
+	return gin.H{"message": message}, nil
+}
+
+// wsSendGroupMessage 通过WebSocket发送群聊消息
+func wsSendGroupMessage(c *websocket.Client, payload json.RawMessage) (interface{}, error) {
+	var req SendGroupMessageRequest
+	if err := bindWSPayload(payload, &req); err != nil {
+		return nil, err
+	}
+
+	message, err := sendGroupMessage(c.Hub, c.UserID, &req)
+	if err != nil {
+		return nil, wsError(err)
+	}
+
+	return gin.H{"message": message}, nil
+}
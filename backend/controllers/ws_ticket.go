@@ -0,0 +1,67 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yourusername/gin-vue-chat/config"
+	"github.com/yourusername/gin-vue-chat/middlewares"
+	"github.com/yourusername/gin-vue-chat/models"
+	"github.com/yourusername/gin-vue-chat/websocket"
+)
+
+// WSAuthRequest WebSocket认证消息，票据和令牌二选一
+type WSAuthRequest struct {
+	Ticket string `json:"ticket"`
+	Token  string `json:"token"`
+}
+
+// RegisterWSAuth 允许未携带票据的连接通过第一条消息认证
+func RegisterWSAuth(hub *websocket.Hub) {
+	hub.SetAuthenticator(wsAuthenticate)
+}
+
+// IssueWSTicket 签发一次性的WebSocket连接票据
+func IssueWSTicket(c *gin.Context) {
+	userID := c.GetString("userId")
+
+	ticket, err := models.CreateWSTicket(userID, config.AppConfig.WebSocket.TicketTTL)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成票据失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"ticket":    ticket.ID,
+		"expiresAt": ticket.ExpiresAt,
+	})
+}
+
+// wsAuthenticate 校验WebSocket认证消息中的票据或令牌
+func wsAuthenticate(payload json.RawMessage) (string, error) {
+	var req WSAuthRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return "", websocket.NewError(http.StatusBadRequest, "请求参数无效")
+	}
+
+	switch {
+	case req.Ticket != "":
+		userID, err := models.ConsumeWSTicket(req.Ticket)
+		if errors.Is(err, models.ErrWSTicketInvalid) {
+			return "", websocket.NewError(http.StatusUnauthorized, err.Error())
+		}
+		return userID, err
+
+	case req.Token != "":
+		userID, err := middlewares.ParseToken(req.Token)
+		if err != nil {
+			return "", websocket.NewError(http.StatusUnauthorized, err.Error())
+		}
+		return userID, nil
+
+	default:
+		return "", websocket.NewError(http.StatusUnauthorized, "未提供认证令牌")
+	}
+}
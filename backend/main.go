@@ -1,12 +1,15 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
-	"time"
+	"os"
+	"os/signal"
+	"syscall"
 
-	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
 	"github.com/yourusername/gin-vue-chat/config"
 	"github.com/yourusername/gin-vue-chat/controllers"
 	"github.com/yourusername/gin-vue-chat/middlewares"
@@ -27,19 +30,27 @@ func main() {
 	// 创建Gin实例
 	r := gin.Default()
 
-	// 配置CORS
-	r.Use(cors.New(cors.Config{
-		AllowOrigins:     []string{"http://localhost:3000"},
-		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
-		AllowCredentials: true,
-		MaxAge:           12 * time.Hour,
-	}))
+	// 配置CORS，允许的来源与WebSocket升级共用同一策略
+	r.Use(middlewares.CORS())
 
 	// 初始化WebSocket管理器
 	hub := websocket.NewHub()
+	hub.SetOriginChecker(middlewares.AllowOrigin)
+	hub.SetPendingStore(websocket.NewMongoPendingStore(models.MongoDatabase.Collection("pending_events"), models.MongoDatabase.Collection("pending_cursors")))
+	if config.AppConfig.Broker.Type == "redis" {
+		// 多实例部署时通过Redis转发消息给连接在其他实例上的用户
+		hub.SetBroker(websocket.NewRedisBroker(&redis.Options{
+			Addr:     config.AppConfig.Broker.RedisAddr,
+			Password: config.AppConfig.Broker.RedisPassword,
+			DB:       config.AppConfig.Broker.RedisDB,
+		}, config.AppConfig.Broker.Channel))
+	}
+	controllers.RegisterWSHandlers(hub)
+	controllers.RegisterWSAuth(hub)
+	controllers.RegisterPresence(hub)
+	controllers.RegisterRooms(hub)
 	go hub.Run()
+	controllers.ResumeCallTimeouts(hub)
 
 	// 将WebSocket Hub添加到Gin上下文中
 	r.Use(func(c *gin.Context) {
@@ -98,11 +109,70 @@ func main() {
 			messages.POST("/private", controllers.SendPrivateMessage)
 			messages.GET("/group/:groupId", controllers.GetGroupMessages)
 			messages.POST("/group", controllers.SendGroupMessage)
+			messages.POST("/read", controllers.MarkRead)
+			messages.GET("/search", controllers.SearchMessages)
+			messages.PUT("/:messageId", controllers.EditMessage)
+			messages.DELETE("/:messageId", controllers.RecallMessage)
+			messages.GET("/:messageId/revisions", controllers.GetMessageRevisions)
+			messages.GET("/:messageId/thread", controllers.GetThread)
+			messages.GET("/:messageId/reads", controllers.GetMessageReads)
+			messages.POST("/:messageId/reactions", controllers.AddReaction)
+			messages.DELETE("/:messageId/reactions/:emoji", controllers.RemoveReaction)
+		}
+
+		// 会话列表路由
+		conversations := protected.Group("/conversations")
+		{
+			conversations.GET("", controllers.GetConversations)
+			conversations.PUT("/:type/:targetId", controllers.UpdateConversation)
+		}
+
+		// @我的消息
+		protected.GET("/mentions", controllers.GetMentions)
+
+		// 通话路由，服务器只负责信令
+		calls := protected.Group("/calls")
+		{
+			calls.POST("", controllers.StartCall)
+			calls.POST("/:callId/accept", controllers.AcceptCall)
+			calls.POST("/:callId/reject", controllers.RejectCall)
+			calls.POST("/:callId/end", controllers.EndCall)
+			calls.POST("/:callId/signal", controllers.SendCallSignal)
 		}
+
+		// 增量同步路由
+		protected.POST("/sync", controllers.Sync)
+
+		// WebSocket连接票据
+		protected.POST("/ws/ticket", controllers.IssueWSTicket)
+
+		// 管理接口
+		admin := protected.Group("/admin")
+		admin.Use(middlewares.AdminOnly())
+		{
+			admin.GET("/hub/clients", controllers.ListHubClients)
+			admin.GET("/hub/stats", controllers.GetHubStats)
+			admin.DELETE("/hub/clients/:clientId", controllers.DisconnectHubClient)
+			admin.DELETE("/hub/users/:userId/clients", controllers.DisconnectUserClients)
+		}
+
+		// 事件推送方式的确认接口
+		protected.POST("/events/ack", controllers.AckEvents)
+	}
+
+	// 无法使用WebSocket时的事件推送方式，浏览器的EventSource无法设置请求头，通过连接票据认证
+	events := r.Group("/api/events")
+	{
+		events.GET("/stream", middlewares.TicketAuth(), func(c *gin.Context) {
+			websocket.ServeSSE(hub, c)
+		})
+		events.GET("/poll", middlewares.PollTicketAuth(), func(c *gin.Context) {
+			websocket.ServeLongPoll(hub, c)
+		})
 	}
 
 	// WebSocket路由
-	r.GET("/ws", middlewares.JWTAuth(), func(c *gin.Context) {
+	r.GET("/ws", middlewares.WSTicketAuth(), func(c *gin.Context) {
 		websocket.ServeWs(hub, c)
 	})
 
@@ -112,8 +182,42 @@ func main() {
 		Handler: r,
 	}
 
-	log.Println("Server is running on http://localhost:8080")
-	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-		log.Fatalf("Failed to start server: %v", err)
+	go func() {
+		log.Println("Server is running on http://localhost:8080")
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("Failed to start server: %v", err)
+		}
+	}()
+
+	// 等待中断信号优雅关闭服务器
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+	log.Println("Shutting down server...")
+
+	ctx, cancel := context.WithTimeout(context.Background(), config.AppConfig.Server.ShutdownTimeout)
+	defer cancel()
+
+	// 先关闭Hub：拒绝新连接，通知客户端重连并发送完缓冲区，
+	// SSE和长轮询请求随之结束，server.Shutdown才不会一直等待它们
+	if err := hub.Shutdown(ctx); err != nil {
+		log.Printf("Hub shutdown: %v", err)
+	}
+
+	// 停止监听并等待进行中的请求完成
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("Server shutdown: %v", err)
+	}
+
+	// 删除本实例剩余的在线记录，例如关闭超时未处理完的用户
+	if err := models.ClearPresenceSessions(hub.ID()); err != nil {
+		log.Printf("Clear presence sessions: %v", err)
 	}
+
+	// 最后关闭MongoDB，确保离线状态等写入已经完成
+	if err := models.CloseMongoDB(ctx); err != nil {
+		log.Printf("MongoDB disconnect: %v", err)
+	}
+
+	log.Println("Server exited")
 }
@@ -0,0 +1,24 @@
+package middlewares
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yourusername/gin-vue-chat/config"
+)
+
+// AdminOnly 只允许配置中的管理员访问，必须在JWTAuth之后使用
+func AdminOnly() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetString("userId")
+		for _, id := range config.AppConfig.Admin.UserIDs {
+			if id == userID {
+				c.Next()
+				return
+			}
+		}
+
+		c.JSON(http.StatusForbidden, gin.H{"error": "需要管理员权限"})
+		c.Abort()
+	}
+}
@@ -0,0 +1,61 @@
+package middlewares
+
+import (
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-contrib/cors"
+	"github.com/gin-gonic/gin"
+	"github.com/yourusername/gin-vue-chat/config"
+)
+
+// CORS 跨域中间件，允许的来源由配置决定
+func CORS() gin.HandlerFunc {
+	return cors.New(cors.Config{
+		AllowOriginFunc:  AllowOrigin,
+		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
+		ExposeHeaders:    []string{"Content-Length"},
+		AllowCredentials: true,
+		MaxAge:           12 * time.Hour,
+	})
+}
+
+// AllowOrigin 判断来源是否在允许列表中，REST接口和WebSocket升级共用。
+// 列表项支持"*"（允许所有来源）和"https://*.example.com"（允许example.com的任意子域名）
+func AllowOrigin(origin string) bool {
+	for _, allowed := range config.AppConfig.CORS.AllowOrigins {
+		if matchOrigin(allowed, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchOrigin 判断来源是否匹配一个允许项
+func matchOrigin(allowed, origin string) bool {
+	if allowed == "*" {
+		return true
+	}
+	if strings.EqualFold(allowed, origin) {
+		return true
+	}
+	if !strings.Contains(allowed, "://*.") {
+		return false
+	}
+
+	pattern, err := url.Parse(strings.Replace(allowed, "://*.", "://", 1))
+	if err != nil {
+		return false
+	}
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+
+	// 协议和端口必须一致，主机名必须是子域名而不是域名本身
+	return strings.EqualFold(u.Scheme, pattern.Scheme) &&
+		u.Port() == pattern.Port() &&
+		strings.HasSuffix(strings.ToLower(u.Hostname()), "."+strings.ToLower(pattern.Hostname()))
+}
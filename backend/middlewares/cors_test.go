@@ -0,0 +1,34 @@
+package middlewares
+
+import "testing"
+
+func TestMatchOrigin(t *testing.T) {
+	tests := []struct {
+		allowed string
+		origin  string
+		want    bool
+	}{
+		{"*", "https://any.site", true},
+		{"https://example.com", "https://example.com", true},
+		{"https://example.com", "HTTPS://Example.com", true},
+		{"https://example.com", "https://app.example.com", false},
+		{"https://*.example.com", "https://app.example.com", true},
+		{"https://*.example.com", "https://a.b.example.com", true},
+		{"https://*.example.com", "https://APP.Example.COM", true},
+		{"https://*.example.com", "https://example.com", false},
+		{"https://*.example.com", "https://evil-example.com", false},
+		{"https://*.example.com", "https://app.example.com.evil.com", false},
+		{"https://*.example.com", "http://app.example.com", false},
+		{"https://*.example.com", "https://app.example.com:8443", false},
+		{"https://*.example.com:8443", "https://app.example.com:8443", true},
+		{"https://*.example.com:8443", "https://app.example.com", false},
+		{"https://*.example.com", "null", false},
+		{"https://*.example.com", "", false},
+	}
+
+	for _, tt := range tests {
+		if got := matchOrigin(tt.allowed, tt.origin); got != tt.want {
+			t.Errorf("matchOrigin(%q, %q) = %v，期望 %v", tt.allowed, tt.origin, got, tt.want)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package middlewares
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
@@ -13,17 +14,12 @@ import (
 // JWTAuth 是JWT认证中间件
 func JWTAuth() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// 从请求头获取token
+		// 从请求头获取token，WebSocket连接使用票据认证，不再接受URL参数中的token
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
-			// 尝试从URL参数获取token（用于WebSocket连接）
-			token := c.Query("token")
-			if token == "" {
-				c.JSON(http.StatusUnauthorized, gin.H{"error": "未提供认证令牌"})
-				c.Abort()
-				return
-			}
-			authHeader = "Bearer " + token
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "未提供认证令牌"})
+			c.Abort()
+			return
 		}
 
 		// 检查token格式
@@ -34,39 +30,44 @@ func JWTAuth() gin.HandlerFunc {
 			return
 		}
 
-		tokenString := parts[1]
-
-		// 解析token
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			// 验证签名算法
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("意外的签名方法: %v", token.Header["alg"])
-			}
-			return []byte(config.AppConfig.JWT.Secret), nil
-		})
-
+		userID, err := ParseToken(parts[1])
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "无效的认证令牌: " + err.Error()})
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 			c.Abort()
 			return
 		}
 
-		// 验证token
-		if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-			// 设置用户ID到上下文
-			userID, ok := claims["userId"].(string)
-			if !ok {
-				c.JSON(http.StatusUnauthorized, gin.H{"error": "无效的用户ID"})
-				c.Abort()
-				return
-			}
+		// 设置用户ID到上下文
+		c.Set("userId", userID)
+		c.Next()
+	}
+}
 
-			c.Set("userId", userID)
-			c.Next()
-		} else {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "无效的认证令牌"})
-			c.Abort()
-			return
+// ParseToken 校验JWT令牌并返回其中的用户ID
+func ParseToken(tokenString string) (string, error) {
+	// 解析token
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		// 验证签名算法
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("意外的签名方法: %v", token.Header["alg"])
 		}
+		return []byte(config.AppConfig.JWT.Secret), nil
+	})
+
+	if err != nil {
+		return "", errors.New("无效的认证令牌: " + err.Error())
+	}
+
+	// 验证token
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return "", errors.New("无效的认证令牌")
 	}
+
+	userID, ok := claims["userId"].(string)
+	if !ok {
+		return "", errors.New("无效的用户ID")
+	}
+
+	return userID, nil
 }
@@ -0,0 +1,79 @@
+package middlewares
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yourusername/gin-vue-chat/models"
+)
+
+// WSTicketAuth WebSocket连接的票据认证中间件。
+// 携带票据时校验并消费票据；未携带时交给连接建立后的认证消息处理
+func WSTicketAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Query("ticket") == "" && c.Query("token") == "" {
+			c.Next()
+			return
+		}
+		ticketAuth(c)
+	}
+}
+
+// TicketAuth 事件流的票据认证中间件。浏览器的EventSource无法设置请求头，
+// 建立连接时必须携带一次性票据
+func TicketAuth() gin.HandlerFunc {
+	return ticketAuth
+}
+
+// PollTicketAuth 长轮询的票据认证中间件。创建会话的请求必须携带一次性票据，
+// 继续已有会话的请求由ServeLongPoll按会话校验
+func PollTicketAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Query("ticket") == "" && c.Query("token") == "" && c.Query("session") != "" {
+			c.Next()
+			return
+		}
+		ticketAuth(c)
+	}
+}
+
+// rejectURLToken 拒绝通过URL参数传递的令牌，返回是否已拒绝
+func rejectURLToken(c *gin.Context) bool {
+	// 长期有效的令牌会出现在代理和访问日志中，不再接受
+	if c.Query("token") == "" {
+		return false
+	}
+
+	c.JSON(http.StatusUnauthorized, gin.H{"error": "不再支持通过URL参数传递令牌，请使用连接票据"})
+	c.Abort()
+	return true
+}
+
+// ticketAuth 校验并消费URL参数中的票据
+func ticketAuth(c *gin.Context) {
+	if rejectURLToken(c) {
+		return
+	}
+
+	ticket := c.Query("ticket")
+	if ticket == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "缺少连接票据"})
+		c.Abort()
+		return
+	}
+
+	userID, err := models.ConsumeWSTicket(ticket)
+	if err != nil {
+		if !errors.Is(err, models.ErrWSTicketInvalid) {
+			log.Printf("校验连接票据失败: %v", err)
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": models.ErrWSTicketInvalid.Error()})
+		c.Abort()
+		return
+	}
+
+	c.Set("userId", userID)
+	c.Next()
+}
@@ -0,0 +1,191 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// 通话状态常量
+const (
+	CallStatusRinging  = "ringing"  // 呼叫中，等待接听
+	CallStatusAccepted = "accepted" // 已接通
+	CallStatusRejected = "rejected" // 被拒绝
+	CallStatusEnded    = "ended"    // 接通后结束
+	CallStatusMissed   = "missed"   // 无人接听或呼叫方取消
+)
+
+// 通话媒体类型常量
+const (
+	CallMediaAudio = "audio" // 语音通话
+	CallMediaVideo = "video" // 视频通话
+)
+
+// ErrCallStateConflict 通话已不处于允许该操作的状态，例如已被其他参与者挂断
+var ErrCallStateConflict = errors.New("通话状态已变化")
+
+// Call MongoDB中的通话会话，服务器只负责信令，媒体由参与者之间直接传输
+type Call struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Type         string             `bson:"type" json:"type"` // private, group
+	CallerID     string             `bson:"callerId" json:"callerId"`
+	ReceiverID   string             `bson:"receiverId,omitempty" json:"receiverId,omitempty"` // 私聊通话的被叫
+	GroupID      string             `bson:"groupId,omitempty" json:"groupId,omitempty"`       // 群组通话的群组ID
+	Media        string             `bson:"media" json:"media"`                               // audio, video
+	Status       string             `bson:"status" json:"status"`
+	Invitees     []string           `bson:"invitees" json:"invitees"`         // 被呼叫的用户
+	Participants []string           `bson:"participants" json:"participants"` // 当前在通话中的用户
+	CreatedAt    time.Time          `bson:"createdAt" json:"createdAt"`
+	AnsweredAt   *time.Time         `bson:"answeredAt,omitempty" json:"answeredAt,omitempty"`
+	EndedAt      *time.Time         `bson:"endedAt,omitempty" json:"endedAt,omitempty"`
+}
+
+// Finished 通话是否已经结束
+func (c *Call) Finished() bool {
+	return c.Status != CallStatusRinging && c.Status != CallStatusAccepted
+}
+
+// Duration 接通后的通话时长
+func (c *Call) Duration() time.Duration {
+	if c.AnsweredAt == nil || c.EndedAt == nil {
+		return 0
+	}
+	return c.EndedAt.Sub(*c.AnsweredAt)
+}
+
+// IsInvitee 用户是否是通话的呼叫方或被呼叫方
+func (c *Call) IsInvitee(userID string) bool {
+	if c.CallerID == userID {
+		return true
+	}
+	for _, id := range c.Invitees {
+		if id == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// IsParticipant 用户是否在通话中
+func (c *Call) IsParticipant(userID string) bool {
+	for _, id := range c.Participants {
+		if id == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateCall 创建通话会话，呼叫方自动成为参与者
+func CreateCall(callType, callerID, receiverID, groupID, media string, invitees []string) (*Call, error) {
+	call := &Call{
+		Type:         callType,
+		CallerID:     callerID,
+		ReceiverID:   receiverID,
+		GroupID:      groupID,
+		Media:        media,
+		Status:       CallStatusRinging,
+		Invitees:     invitees,
+		Participants: []string{callerID},
+		CreatedAt:    time.Now(),
+	}
+
+	collection := MongoDatabase.Collection("calls")
+	result, err := collection.InsertOne(context.Background(), call)
+	if err != nil {
+		return nil, err
+	}
+
+	call.ID = result.InsertedID.(primitive.ObjectID)
+	return call, nil
+}
+
+// GetCallByID 通过ID获取通话
+func GetCallByID(id string) (*Call, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+
+	collection := MongoDatabase.Collection("calls")
+	var call Call
+	if err := collection.FindOne(context.Background(), bson.M{"_id": objectID}).Decode(&call); err != nil {
+		return nil, err
+	}
+	return &call, nil
+}
+
+// GetRingingCalls 获取所有仍在呼叫中的通话
+func GetRingingCalls() ([]*Call, error) {
+	collection := MongoDatabase.Collection("calls")
+	cursor, err := collection.Find(context.Background(), bson.M{"status": CallStatusRinging})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	var calls []*Call
+	if err := cursor.All(context.Background(), &calls); err != nil {
+		return nil, err
+	}
+	return calls, nil
+}
+
+// updateCall 仅当通话处于给定状态之一时更新，返回更新后的通话。
+// 多个参与者同时操作时只有一个能成功，其余返回ErrCallStateConflict
+func updateCall(id primitive.ObjectID, from []string, filter bson.M, update bson.M) (*Call, error) {
+	if filter == nil {
+		filter = bson.M{}
+	}
+	filter["_id"] = id
+	filter["status"] = bson.M{"$in": from}
+
+	collection := MongoDatabase.Collection("calls")
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var call Call
+	err := collection.FindOneAndUpdate(context.Background(), filter, update, opts).Decode(&call)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrCallStateConflict
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &call, nil
+}
+
+// AcceptCall 用户接听通话，第一个接听的用户使通话进入接通状态
+func AcceptCall(id primitive.ObjectID, userID string) (*Call, error) {
+	now := time.Now()
+	call, err := updateCall(id, []string{CallStatusRinging}, nil, bson.M{
+		"$set":      bson.M{"status": CallStatusAccepted, "answeredAt": now},
+		"$addToSet": bson.M{"participants": userID},
+	})
+	if !errors.Is(err, ErrCallStateConflict) {
+		return call, err
+	}
+
+	// 群组通话接通后其他成员仍可加入
+	return updateCall(id, []string{CallStatusAccepted}, nil, bson.M{
+		"$addToSet": bson.M{"participants": userID},
+	})
+}
+
+// LeaveCall 参与者离开已接通的通话，不改变通话状态
+func LeaveCall(id primitive.ObjectID, userID string) (*Call, error) {
+	return updateCall(id, []string{CallStatusAccepted}, bson.M{"participants": userID}, bson.M{
+		"$pull": bson.M{"participants": userID},
+	})
+}
+
+// FinishCall 结束通话并记录最终状态，只有仍在进行中的通话可以结束
+func FinishCall(id primitive.ObjectID, from []string, status string) (*Call, error) {
+	return updateCall(id, from, nil, bson.M{
+		"$set": bson.M{"status": status, "endedAt": time.Now(), "participants": []string{}},
+	})
+}
@@ -0,0 +1,431 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// maxUnreadCount 未读数的统计上限，客户端显示为"99+"之类即可
+	maxUnreadCount = 999
+
+	// 重新统计未读数时与新消息冲突的最大重试次数
+	unreadRefreshRetries = 3
+
+	// 会话列表补建任务在migrations集合中的记录ID
+	conversationsBackfill = "conversations_backfill"
+)
+
+// Conversation MongoDB中用户的会话列表项，每个用户在每个会话中一条。
+// 收到消息、标记已读、编辑或撤回最后一条消息时增量更新
+type Conversation struct {
+	ID             primitive.ObjectID `bson:"_id,omitempty" json:"-"`
+	UserID         string             `bson:"userId" json:"-"`
+	Type           string             `bson:"type" json:"type"`         // private, group
+	TargetID       string             `bson:"targetId" json:"targetId"` // 私聊时为对方用户ID，群聊时为群组ID
+	LastMessage    *MessageQuote      `bson:"lastMessage,omitempty" json:"lastMessage,omitempty"`
+	LastActivityAt time.Time          `bson:"lastActivityAt" json:"lastActivityAt"`
+	UnreadCount    int64              `bson:"unreadCount" json:"unreadCount"`
+	Muted          bool               `bson:"muted" json:"muted"`   // 免打扰
+	Pinned         bool               `bson:"pinned" json:"pinned"` // 置顶
+	UpdatedAt      time.Time          `bson:"updatedAt" json:"updatedAt"`
+
+	// 未读数的版本号，每次修改未读数时加一，重新统计时按版本号条件写入
+	UnreadVersion int64 `bson:"unreadVersion,omitempty" json:"-"`
+	// 最近一次重新统计包含的最新消息位置，之前的消息不再单独增加未读数
+	UnreadThroughAt time.Time          `bson:"unreadThroughAt,omitempty" json:"-"`
+	UnreadThroughID primitive.ObjectID `bson:"unreadThroughId,omitempty" json:"-"`
+}
+
+// ensureConversationIndexes 建立会话列表的唯一索引和排序索引
+func ensureConversationIndexes() {
+	collection := MongoDatabase.Collection("conversations")
+	_, err := collection.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+		{
+			Keys: bson.D{
+				{Key: "userId", Value: 1},
+				{Key: "type", Value: 1},
+				{Key: "targetId", Value: 1},
+			},
+			Options: options.Index().SetUnique(true),
+		},
+		{Keys: bson.D{
+			{Key: "userId", Value: 1},
+			{Key: "pinned", Value: -1},
+			{Key: "lastActivityAt", Value: -1},
+		}},
+		{Keys: bson.D{{Key: "lastMessage.id", Value: 1}}, Options: options.Index().SetSparse(true)},
+		{Keys: bson.D{{Key: "type", Value: 1}, {Key: "targetId", Value: 1}}},
+	})
+	if err != nil {
+		log.Printf("创建会话索引失败: %v", err)
+	}
+}
+
+// conversationFilter 用户某个会话的查询条件
+func conversationFilter(userID, conversationType, targetID string) bson.M {
+	return bson.M{"userId": userID, "type": conversationType, "targetId": targetID}
+}
+
+// TouchConversation 确保用户的会话列表中有该会话，例如加入群组或添加好友时
+func TouchConversation(userID, conversationType, targetID string, at time.Time) error {
+	collection := MongoDatabase.Collection("conversations")
+	_, err := collection.UpdateOne(context.Background(), conversationFilter(userID, conversationType, targetID), bson.M{
+		"$setOnInsert": bson.M{
+			"lastActivityAt": at,
+			"unreadCount":    0,
+			"muted":          false,
+			"pinned":         false,
+			"updatedAt":      at,
+		},
+	}, options.Update().SetUpsert(true))
+	return err
+}
+
+// DeleteConversation 从用户的会话列表中移除会话，例如被移出群组时
+func DeleteConversation(userID, conversationType, targetID string) error {
+	collection := MongoDatabase.Collection("conversations")
+	_, err := collection.DeleteOne(context.Background(), conversationFilter(userID, conversationType, targetID))
+	return err
+}
+
+// GetConversations 获取用户的会话列表，置顶的会话在前，其余按最后活动时间倒序
+func GetConversations(userID string) ([]*Conversation, error) {
+	opts := options.Find().SetSort(bson.D{
+		{Key: "pinned", Value: -1},
+		{Key: "lastActivityAt", Value: -1},
+	})
+
+	collection := MongoDatabase.Collection("conversations")
+	cursor, err := collection.Find(context.Background(), bson.M{"userId": userID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	conversations := []*Conversation{}
+	if err := cursor.All(context.Background(), &conversations); err != nil {
+		return nil, err
+	}
+	return conversations, nil
+}
+
+// GetMutedTargets 获取用户设为免打扰的某类会话，返回私聊对方用户ID或群组ID的集合
+func GetMutedTargets(userID, conversationType string) (map[string]bool, error) {
+	collection := MongoDatabase.Collection("conversations")
+	opts := options.Find().SetProjection(bson.M{"targetId": 1})
+	cursor, err := collection.Find(context.Background(), bson.M{"userId": userID, "type": conversationType, "muted": true}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	var conversations []*Conversation
+	if err := cursor.All(context.Background(), &conversations); err != nil {
+		return nil, err
+	}
+
+	muted := make(map[string]bool, len(conversations))
+	for _, conversation := range conversations {
+		muted[conversation.TargetID] = true
+	}
+	return muted, nil
+}
+
+// UpdateConversationSettings 修改会话的免打扰和置顶设置，参数为nil时不修改
+func UpdateConversationSettings(userID, conversationType, targetID string, muted, pinned *bool) (*Conversation, error) {
+	now := time.Now()
+	set := bson.M{"updatedAt": now}
+	setOnInsert := bson.M{"lastActivityAt": now, "unreadCount": 0}
+	if muted != nil {
+		set["muted"] = *muted
+	} else {
+		setOnInsert["muted"] = false
+	}
+	if pinned != nil {
+		set["pinned"] = *pinned
+	} else {
+		setOnInsert["pinned"] = false
+	}
+
+	collection := MongoDatabase.Collection("conversations")
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	var conversation Conversation
+	err := collection.FindOneAndUpdate(context.Background(), conversationFilter(userID, conversationType, targetID),
+		bson.M{"$set": set, "$setOnInsert": setOnInsert}, opts).Decode(&conversation)
+	if err != nil {
+		return nil, err
+	}
+	return &conversation, nil
+}
+
+// updateConversationsForMessage 新消息保存后更新双方或所有群组成员的会话列表，
+// 接收者的未读数加一。话题回复不出现在群聊消息列表中，不更新会话
+func updateConversationsForMessage(message *Message) error {
+	if message.ThreadID != "" {
+		return nil
+	}
+	if message.Type == MessageTypeGroup {
+		return updateGroupConversations(message)
+	}
+
+	preview := NewMessageQuote(message)
+	entries := [][2]string{{message.SenderID, message.ReceiverID}, {message.ReceiverID, message.SenderID}}
+	upserts := make([]mongo.WriteModel, 0, len(entries))
+	for _, e := range entries {
+		upserts = append(upserts, mongo.NewUpdateOneModel().
+			SetFilter(conversationFilter(e[0], message.Type, e[1])).
+			SetUpdate(bson.M{
+				"$set":         bson.M{"lastMessage": preview, "updatedAt": time.Now()},
+				"$max":         bson.M{"lastActivityAt": message.Timestamp},
+				"$setOnInsert": bson.M{"unreadCount": 0, "muted": false, "pinned": false},
+			}).
+			SetUpsert(true))
+	}
+
+	collection := MongoDatabase.Collection("conversations")
+	if _, err := collection.BulkWrite(context.Background(), upserts, options.BulkWrite().SetOrdered(false)); err != nil {
+		return err
+	}
+
+	// 未达到上限且不在最近一次重新统计范围内时才加一
+	filter := conversationFilter(message.ReceiverID, message.Type, message.SenderID)
+	filter["unreadCount"] = bson.M{"$lt": maxUnreadCount}
+	filter["$or"] = []bson.M{
+		{"unreadThroughAt": bson.M{"$exists": false}},
+		{"unreadThroughAt": bson.M{"$lt": message.Timestamp}},
+		{"unreadThroughAt": message.Timestamp, "unreadThroughId": bson.M{"$lt": message.ID}},
+	}
+	_, err := collection.UpdateOne(context.Background(), filter, bson.M{"$inc": bson.M{"unreadCount": 1, "unreadVersion": 1}})
+	return err
+}
+
+// updateGroupConversations 用一次UpdateMany更新所有群组成员的会话，不需要加载成员列表。
+// 群组成员的会话在加入群组时建立，除发送者外的成员未读数加一，条件与私聊相同
+func updateGroupConversations(message *Message) error {
+	counted := bson.M{"$and": bson.A{
+		bson.M{"$ne": bson.A{"$userId", message.SenderID}},
+		bson.M{"$lt": bson.A{"$unreadCount", maxUnreadCount}},
+		// 没有统计位置时字段为null，小于任何时间
+		bson.M{"$or": bson.A{
+			bson.M{"$lt": bson.A{"$unreadThroughAt", message.Timestamp}},
+			bson.M{"$and": bson.A{
+				bson.M{"$eq": bson.A{"$unreadThroughAt", message.Timestamp}},
+				bson.M{"$lt": bson.A{"$unreadThroughId", message.ID}},
+			}},
+		}},
+	}}
+
+	collection := MongoDatabase.Collection("conversations")
+	_, err := collection.UpdateMany(context.Background(),
+		bson.M{"type": MessageTypeGroup, "targetId": message.GroupID},
+		mongo.Pipeline{{{Key: "$set", Value: bson.M{
+			// 预览中的内容可能以$开头，按字面值写入
+			"lastMessage":    bson.M{"$literal": NewMessageQuote(message)},
+			"updatedAt":      time.Now(),
+			"lastActivityAt": bson.M{"$max": bson.A{"$lastActivityAt", message.Timestamp}},
+			"unreadCount":    bson.M{"$cond": bson.A{counted, bson.M{"$add": bson.A{"$unreadCount", 1}}, "$unreadCount"}},
+			"unreadVersion":  bson.M{"$cond": bson.A{counted, bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$unreadVersion", 0}}, 1}}, "$unreadVersion"}},
+		}}}})
+	return err
+}
+
+// updateConversationPreviews 最后一条消息被编辑或撤回后更新会话列表中的预览
+func updateConversationPreviews(message *Message) error {
+	preview := NewMessageQuote(message)
+
+	collection := MongoDatabase.Collection("conversations")
+	_, err := collection.UpdateMany(context.Background(), bson.M{"lastMessage.id": preview.ID}, bson.M{
+		"$set": bson.M{"lastMessage": preview},
+	})
+	return err
+}
+
+// unreadFilter 计入用户未读数的消息：会话中他人发送的、不属于话题的消息
+func unreadFilter(userID, conversationType, targetID string) bson.M {
+	if conversationType == MessageTypeGroup {
+		return bson.M{
+			"type":     MessageTypeGroup,
+			"groupId":  targetID,
+			"senderId": bson.M{"$ne": userID},
+			"threadId": bson.M{"$exists": false},
+		}
+	}
+	return bson.M{"type": MessageTypePrivate, "senderId": targetID, "receiverId": userID}
+}
+
+// refreshUnreadCount 已读位置移动后重新统计未读数，只统计已读位置之后他人发送的消息。
+// 统计截止到当前最新的消息并记录该位置，之后到达的消息仍然单独加一；
+// 统计期间未读数被修改时按版本号判断冲突并重试
+func refreshUnreadCount(userID, conversationType, targetID string, state *ReadState) error {
+	collection := MongoDatabase.Collection("conversations")
+	messages := MongoDatabase.Collection("messages")
+	filter := unreadFilter(userID, conversationType, targetID)
+
+	for attempt := 0; attempt < unreadRefreshRetries; attempt++ {
+		var conversation Conversation
+		err := collection.FindOne(context.Background(), conversationFilter(userID, conversationType, targetID)).Decode(&conversation)
+		if err == mongo.ErrNoDocuments {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var newest Message
+		err = messages.FindOne(context.Background(), filter, options.FindOne().
+			SetSort(bson.D{{Key: "timestamp", Value: -1}, {Key: "_id", Value: -1}}).
+			SetProjection(bson.M{"_id": 1, "timestamp": 1})).Decode(&newest)
+		if err != nil && err != mongo.ErrNoDocuments {
+			return err
+		}
+
+		set := bson.M{"unreadCount": 0, "updatedAt": time.Now()}
+		if err == nil {
+			count, err := messages.CountDocuments(context.Background(), bson.M{"$and": []bson.M{
+				filter,
+				cursorCondition("$gt", state.Cursor()),
+				{"$or": []bson.M{
+					{"timestamp": bson.M{"$lt": newest.Timestamp}},
+					{"timestamp": newest.Timestamp, "_id": bson.M{"$lte": newest.ID}},
+				}},
+			}}, options.Count().SetLimit(maxUnreadCount))
+			if err != nil {
+				return err
+			}
+			set["unreadCount"] = count
+			set["unreadThroughAt"] = newest.Timestamp
+			set["unreadThroughId"] = newest.ID
+		}
+
+		guard := conversationFilter(userID, conversationType, targetID)
+		if conversation.UnreadVersion == 0 {
+			guard["unreadVersion"] = bson.M{"$in": bson.A{0, nil}}
+		} else {
+			guard["unreadVersion"] = conversation.UnreadVersion
+		}
+		result, err := collection.UpdateOne(context.Background(), guard, bson.M{
+			"$set": set,
+			"$inc": bson.M{"unreadVersion": 1},
+		})
+		if err != nil {
+			return err
+		}
+		if result.MatchedCount > 0 {
+			return nil
+		}
+	}
+
+	return errors.New("未读数更新冲突")
+}
+
+// backfillConversations 为会话列表上线前已有的好友和群组建立会话，只执行一次
+func backfillConversations() {
+	migrations := MongoDatabase.Collection("migrations")
+	err := migrations.FindOne(context.Background(), bson.M{"_id": conversationsBackfill}).Err()
+	if err == nil {
+		return
+	}
+	if err != mongo.ErrNoDocuments {
+		log.Printf("补建会话列表失败: %v", err)
+		return
+	}
+
+	total := 0
+	friendships, err := MongoDatabase.Collection("friendships").Find(context.Background(),
+		bson.M{"status": "accepted", "deleted": false})
+	if err != nil {
+		log.Printf("补建会话列表失败: %v", err)
+		return
+	}
+	for friendships.Next(context.Background()) {
+		var friendship Friendship
+		if err := friendships.Decode(&friendship); err != nil {
+			log.Printf("补建会话列表失败: %v", err)
+			friendships.Close(context.Background())
+			return
+		}
+		for _, pair := range [][2]string{{friendship.UserID, friendship.FriendID}, {friendship.FriendID, friendship.UserID}} {
+			if err := backfillConversation(pair[0], MessageTypePrivate, pair[1], friendship.UpdatedAt); err != nil {
+				log.Printf("补建会话列表失败: %v", err)
+				friendships.Close(context.Background())
+				return
+			}
+			total++
+		}
+	}
+	friendships.Close(context.Background())
+
+	members, err := MongoDatabase.Collection("group_members").Find(context.Background(), bson.M{"deleted": false})
+	if err != nil {
+		log.Printf("补建会话列表失败: %v", err)
+		return
+	}
+	defer members.Close(context.Background())
+	for members.Next(context.Background()) {
+		var member GroupMember
+		if err := members.Decode(&member); err != nil {
+			log.Printf("补建会话列表失败: %v", err)
+			return
+		}
+		if err := backfillConversation(member.UserID, MessageTypeGroup, member.GroupID, member.CreatedAt); err != nil {
+			log.Printf("补建会话列表失败: %v", err)
+			return
+		}
+		total++
+	}
+
+	if _, err := migrations.InsertOne(context.Background(), bson.M{"_id": conversationsBackfill, "completedAt": time.Now()}); err != nil {
+		log.Printf("记录会话列表补建失败: %v", err)
+		return
+	}
+	log.Printf("已为 %d 个已有会话补建会话列表", total)
+}
+
+// backfillConversation 按最后一条消息和已读位置补建一个会话，会话已存在时不修改。
+// 没有已读位置的会话视为历史消息已读，未读数为0
+func backfillConversation(userID, conversationType, targetID string, since time.Time) error {
+	filter := privateConversationFilter(userID, targetID)
+	if conversationType == MessageTypeGroup {
+		filter = bson.M{"type": MessageTypeGroup, "groupId": targetID, "threadId": bson.M{"$exists": false}}
+	}
+
+	setOnInsert := bson.M{
+		"lastActivityAt": since,
+		"unreadCount":    0,
+		"muted":          false,
+		"pinned":         false,
+		"updatedAt":      time.Now(),
+	}
+
+	var last Message
+	err := MongoDatabase.Collection("messages").FindOne(context.Background(), filter,
+		options.FindOne().SetSort(bson.D{{Key: "timestamp", Value: -1}, {Key: "_id", Value: -1}})).Decode(&last)
+	if err == nil {
+		setOnInsert["lastMessage"] = NewMessageQuote(&last)
+		setOnInsert["lastActivityAt"] = last.Timestamp
+	} else if err != mongo.ErrNoDocuments {
+		return err
+	}
+
+	collection := MongoDatabase.Collection("conversations")
+	result, err := collection.UpdateOne(context.Background(), conversationFilter(userID, conversationType, targetID),
+		bson.M{"$setOnInsert": setOnInsert}, options.Update().SetUpsert(true))
+	if err != nil || result.UpsertedCount == 0 {
+		return err
+	}
+
+	state, err := GetReadState(userID, conversationType, targetID)
+	if err != nil || state == nil {
+		return err
+	}
+	return refreshUnreadCount(userID, conversationType, targetID, state)
+}
@@ -0,0 +1,155 @@
+package models
+
+import (
+	"context"
+	"log"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// 会话状态变化类型常量
+const (
+	ConversationEventMemberAdded     = "member_added"     // 群组成员加入
+	ConversationEventMemberRemoved   = "member_removed"   // 群组成员移除
+	ConversationEventGroupDeleted    = "group_deleted"    // 群组解散
+	ConversationEventMessageEdited   = "message_edited"   // 消息被编辑
+	ConversationEventMessageRecalled = "message_recalled" // 消息被撤回或删除
+)
+
+// ConversationEvent MongoDB中的会话状态变化记录，供客户端增量同步
+type ConversationEvent struct {
+	ID        primitive.ObjectID     `bson:"_id,omitempty" json:"id"`
+	Type      string                 `bson:"type" json:"type"`                           // private, group
+	UserIDs   []string               `bson:"userIds,omitempty" json:"userIds,omitempty"` // 私聊时的两个用户ID
+	GroupID   string                 `bson:"groupId,omitempty" json:"groupId,omitempty"` // 群聊时的群组ID
+	Event     string                 `bson:"event" json:"event"`
+	ActorID   string                 `bson:"actorId" json:"actorId"` // 触发变化的用户ID
+	Data      map[string]interface{} `bson:"data,omitempty" json:"data,omitempty"`
+	CreatedAt time.Time              `bson:"createdAt" json:"createdAt"`
+}
+
+// Cursor 返回指向状态变化的游标，与消息游标一样按时间和ID排序
+func (e *ConversationEvent) Cursor() *MessageCursor {
+	return &MessageCursor{Timestamp: e.CreatedAt, ID: e.ID}
+}
+
+// RecordPrivateEvent 记录私聊会话的状态变化
+func RecordPrivateEvent(userID1, userID2, event, actorID string, data map[string]interface{}) error {
+	userIDs := []string{userID1, userID2}
+	sort.Strings(userIDs)
+
+	return recordConversationEvent(&ConversationEvent{
+		Type:    MessageTypePrivate,
+		UserIDs: userIDs,
+		Event:   event,
+		ActorID: actorID,
+		Data:    data,
+	})
+}
+
+// RecordGroupEvent 记录群组会话的状态变化
+func RecordGroupEvent(groupID, event, actorID string, data map[string]interface{}) error {
+	return recordConversationEvent(&ConversationEvent{
+		Type:    MessageTypeGroup,
+		GroupID: groupID,
+		Event:   event,
+		ActorID: actorID,
+		Data:    data,
+	})
+}
+
+// recordConversationEvent 保存会话状态变化
+func recordConversationEvent(event *ConversationEvent) error {
+	event.CreatedAt = time.Now()
+
+	collection := MongoDatabase.Collection("conversation_events")
+	result, err := collection.InsertOne(context.Background(), event)
+	if err != nil {
+		return err
+	}
+
+	event.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+// RedactMessageEdits 清除消息编辑记录中的内容，消息撤回后增量同步不再返回原文
+func RedactMessageEdits(messageID primitive.ObjectID) error {
+	collection := MongoDatabase.Collection("conversation_events")
+	_, err := collection.UpdateMany(
+		context.Background(),
+		bson.M{"event": ConversationEventMessageEdited, "data.messageId": messageID.Hex()},
+		bson.M{"$unset": bson.M{"data.content": ""}},
+	)
+	return err
+}
+
+// ensureConversationEventIndexes 创建按消息查找状态变化的索引，以及增量同步按会话和时间查询的索引
+func ensureConversationEventIndexes() {
+	collection := MongoDatabase.Collection("conversation_events")
+	_, err := collection.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "data.messageId", Value: 1}},
+			Options: options.Index().SetSparse(true),
+		},
+		{Keys: bson.D{{Key: "type", Value: 1}, {Key: "groupId", Value: 1}, {Key: "createdAt", Value: 1}, {Key: "_id", Value: 1}}},
+		{Keys: bson.D{{Key: "type", Value: 1}, {Key: "userIds", Value: 1}, {Key: "createdAt", Value: 1}, {Key: "_id", Value: 1}}},
+	})
+	if err != nil {
+		log.Printf("创建会话状态变化索引失败: %v", err)
+	}
+}
+
+// findConversationEventsAfter 查询游标之后的会话状态变化，按(createdAt, _id)升序。after为nil时从头开始
+func findConversationEventsAfter(filter bson.M, after *MessageCursor, limit int64) ([]*ConversationEvent, error) {
+	if after != nil {
+		filter = bson.M{"$and": []bson.M{filter, timeCursorCondition("createdAt", "$gt", after)}}
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "createdAt", Value: 1}, {Key: "_id", Value: 1}}).
+		SetLimit(limit)
+
+	collection := MongoDatabase.Collection("conversation_events")
+	cursor, err := collection.Find(context.Background(), filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	var events []*ConversationEvent
+	if err = cursor.All(context.Background(), &events); err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+// GetPrivateEventsAfter 获取两个用户之间私聊会话游标之后的状态变化
+func GetPrivateEventsAfter(userID1, userID2 string, after *MessageCursor, limit int64) ([]*ConversationEvent, error) {
+	userIDs := []string{userID1, userID2}
+	sort.Strings(userIDs)
+
+	return findConversationEventsAfter(bson.M{"type": MessageTypePrivate, "userIds": userIDs}, after, limit)
+}
+
+// GetGroupEventsAfter 获取群组会话游标之后的状态变化
+func GetGroupEventsAfter(groupID string, after *MessageCursor, limit int64) ([]*ConversationEvent, error) {
+	return findConversationEventsAfter(bson.M{"type": MessageTypeGroup, "groupId": groupID}, after, limit)
+}
+
+// GetGroupExitEventsAfter 获取群组游标之后与已离开的用户相关的终止事件：群组解散或该用户被移除
+func GetGroupExitEventsAfter(groupID, userID string, after *MessageCursor, limit int64) ([]*ConversationEvent, error) {
+	return findConversationEventsAfter(bson.M{
+		"type":    MessageTypeGroup,
+		"groupId": groupID,
+		"$or": []bson.M{
+			{"event": ConversationEventGroupDeleted},
+			{"event": ConversationEventMemberRemoved, "data.userId": userID},
+		},
+	}, after, limit)
+}
@@ -44,6 +44,26 @@ func InitMongoDB() {
 
 	// 获取数据库实例
 	MongoDatabase = MongoDB.Database(config.AppConfig.MongoDB.Database)
+	ensureMessageIndexes()
+	ensureWSTicketIndexes()
+	ensureReactionIndexes()
+	ensureReadStateIndexes()
+	ensureConversationIndexes()
+	ensureConversationEventIndexes()
+	ensureSearchIndexes()
+	ensurePresenceSessionIndexes()
+
+	// 后台为上线前的历史数据补建会话列表和搜索词元
+	go backfillConversations()
+	go backfillSearchTokens()
 
 	log.Println("成功连接到MongoDB")
 }
+
+// CloseMongoDB 断开MongoDB连接
+func CloseMongoDB(ctx context.Context) error {
+	if MongoDB == nil {
+		return nil
+	}
+	return MongoDB.Disconnect(ctx)
+}
@@ -8,6 +8,7 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 // Group MongoDB中的群组模型
@@ -233,6 +234,21 @@ func GetGroupMembers(groupID string) ([]*GroupMember, error) {
 	return members, nil
 }
 
+// WasGroupMember 检查用户是否曾经是群组成员，包括已被移除或群组已解散的情况
+func WasGroupMember(groupID, userID string) (bool, error) {
+	collection := MongoDatabase.Collection("group_members")
+	count, err := collection.CountDocuments(
+		context.Background(),
+		bson.M{"groupId": groupID, "userId": userID},
+		options.Count().SetLimit(1),
+	)
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
 // RemoveGroupMember 移除群组成员
 func RemoveGroupMember(groupID, userID string) error {
 	collection := MongoDatabase.Collection("group_members")
@@ -2,10 +2,16 @@ package models
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
@@ -24,19 +30,104 @@ type Message struct {
 	GroupID    string             `bson:"groupId,omitempty" json:"groupId,omitempty"`       // 群聊时的群组ID
 	Content    string             `bson:"content" json:"content"`
 	Timestamp  time.Time          `bson:"timestamp" json:"timestamp"`
-	Read       bool               `bson:"read" json:"read"` // 消息是否已读
+	// 内容类型，为空表示文本消息
+	ContentType string      `bson:"contentType,omitempty" json:"contentType,omitempty"`
+	Call        *CallRecord `bson:"call,omitempty" json:"call,omitempty"` // 通话记录消息的通话信息
+	// 最近一次编辑的时间，未编辑过为空
+	EditedAt *time.Time `bson:"editedAt,omitempty" json:"editedAt,omitempty"`
+	// 编辑前的历史版本，按时间升序，只有发送者和群组管理员可以查看
+	Revisions []MessageRevision `bson:"revisions,omitempty" json:"-"`
+	// 撤回或被管理员删除的时间，撤回后消息只保留占位，内容被清空
+	RecalledAt *time.Time `bson:"recalledAt,omitempty" json:"recalledAt,omitempty"`
+	RecalledBy string     `bson:"recalledBy,omitempty" json:"recalledBy,omitempty"` // 撤回消息的用户ID
+	// 表情回应汇总，单独存储在message_reactions集合，查询历史消息时填充
+	Reactions []*ReactionSummary `bson:"-" json:"reactions,omitempty"`
+	// 回复的消息，保存被引用消息的摘要，原消息不在当前页时也能显示
+	ReplyTo *MessageQuote `bson:"replyTo,omitempty" json:"replyTo,omitempty"`
+	// 群聊话题回复所属的根消息ID，话题回复不出现在群聊消息列表中
+	ThreadID string `bson:"threadId,omitempty" json:"threadId,omitempty"`
+	// 根消息的话题信息，没有回复时为空
+	Thread *ThreadInfo `bson:"thread,omitempty" json:"thread,omitempty"`
+	// 群聊消息中@的成员ID
+	Mentions   []string `bson:"mentions,omitempty" json:"mentions,omitempty"`
+	MentionAll bool     `bson:"mentionAll,omitempty" json:"mentionAll,omitempty"` // 是否@所有人
+	// 内容的搜索词元，由Tokenize生成，没有词元时为空数组，撤回后清空
+	SearchTokens []string `bson:"searchTokens" json:"-"`
 }
 
-// SavePrivateMessage 保存私聊消息到MongoDB
-func SavePrivateMessage(senderID, receiverID, content string) (*Message, error) {
-	message := &Message{
-		Type:       MessageTypePrivate,
-		SenderID:   senderID,
-		ReceiverID: receiverID,
-		Content:    content,
-		Timestamp:  time.Now(),
-		Read:       false,
+// quoteSnippetLength 引用摘要保留的最大字符数
+const quoteSnippetLength = 100
+
+// MessageQuote 被回复消息的摘要
+type MessageQuote struct {
+	ID          string `bson:"id" json:"id"`
+	SenderID    string `bson:"senderId" json:"senderId"`
+	Content     string `bson:"content" json:"content"` // 截断后的内容，原消息撤回后清空
+	ContentType string `bson:"contentType,omitempty" json:"contentType,omitempty"`
+	Recalled    bool   `bson:"recalled,omitempty" json:"recalled,omitempty"`
+}
+
+// NewMessageQuote 生成被回复消息的摘要
+func NewMessageQuote(message *Message) *MessageQuote {
+	return &MessageQuote{
+		ID:          message.ID.Hex(),
+		SenderID:    message.SenderID,
+		Content:     quoteSnippet(message.Content),
+		ContentType: message.ContentType,
+		Recalled:    message.Recalled(),
+	}
+}
+
+// quoteSnippet 截断引用内容
+func quoteSnippet(content string) string {
+	runes := []rune(content)
+	if len(runes) <= quoteSnippetLength {
+		return content
 	}
+	return string(runes[:quoteSnippetLength]) + "…"
+}
+
+// ThreadInfo 话题根消息上的回复统计
+type ThreadInfo struct {
+	ReplyCount   int64     `bson:"replyCount" json:"replyCount"`
+	Participants []string  `bson:"participants" json:"participants"` // 根消息发送者和所有回复者
+	LastReplyAt  time.Time `bson:"lastReplyAt" json:"lastReplyAt"`
+}
+
+// Recalled 消息是否已被撤回
+func (m *Message) Recalled() bool {
+	return m.RecalledAt != nil
+}
+
+// MessageRevision 消息被编辑前的一个版本
+type MessageRevision struct {
+	Content   string    `bson:"content" json:"content"`
+	CreatedAt time.Time `bson:"createdAt" json:"createdAt"` // 该版本的发送或编辑时间
+}
+
+// 消息修改错误
+var (
+	ErrMessageChanged  = errors.New("消息已被修改，请重试")
+	ErrMessageRecalled = errors.New("消息已撤回")
+)
+
+// 消息内容类型常量
+const (
+	ContentTypeCall = "call" // 通话记录
+)
+
+// CallRecord 保存在消息中的通话结果
+type CallRecord struct {
+	CallID   string `bson:"callId" json:"callId"`
+	Media    string `bson:"media" json:"media"`
+	Status   string `bson:"status" json:"status"`     // rejected, ended, missed
+	Duration int64  `bson:"duration" json:"duration"` // 通话时长，单位秒
+}
+
+// SaveMessage 保存消息到MongoDB，发送时间由服务器设置
+func SaveMessage(message *Message) (*Message, error) {
+	message.Timestamp = time.Now()
+	message.SearchTokens = searchTokens(message.Content)
 
 	collection := MongoDatabase.Collection("messages")
 	result, err := collection.InsertOne(context.Background(), message)
@@ -45,85 +136,309 @@ func SavePrivateMessage(senderID, receiverID, content string) (*Message, error)
 	}
 
 	message.ID = result.InsertedID.(primitive.ObjectID)
+
+	if err := updateConversationsForMessage(message); err != nil {
+		log.Printf("更新会话列表失败: %v", err)
+	}
 	return message, nil
 }
 
-// SaveGroupMessage 保存群聊消息到MongoDB
-func SaveGroupMessage(senderID, groupID, content string) (*Message, error) {
-	message := &Message{
-		Type:      MessageTypeGroup,
-		SenderID:  senderID,
-		GroupID:   groupID,
-		Content:   content,
-		Timestamp: time.Now(),
-		Read:      false,
+// SaveCallMessage 保存通话记录消息，与普通消息一起出现在会话中
+func SaveCallMessage(call *Call, content string) (*Message, error) {
+	return SaveMessage(&Message{
+		Type:        call.Type,
+		SenderID:    call.CallerID,
+		ReceiverID:  call.ReceiverID,
+		GroupID:     call.GroupID,
+		Content:     content,
+		ContentType: ContentTypeCall,
+		Call: &CallRecord{
+			CallID:   call.ID.Hex(),
+			Media:    call.Media,
+			Status:   call.Status,
+			Duration: int64(call.Duration().Seconds()),
+		},
+	})
+}
+
+// AddThreadReply 更新话题根消息的回复数、参与者和最后回复时间，返回更新后的根消息
+func AddThreadReply(rootID primitive.ObjectID, participants []string, repliedAt time.Time) (*Message, error) {
+	update := bson.M{
+		"$inc":      bson.M{"thread.replyCount": 1},
+		"$addToSet": bson.M{"thread.participants": bson.M{"$each": participants}},
+		"$max":      bson.M{"thread.lastReplyAt": repliedAt},
 	}
 
 	collection := MongoDatabase.Collection("messages")
-	result, err := collection.InsertOne(context.Background(), message)
-	if err != nil {
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var root Message
+	if err := collection.FindOneAndUpdate(context.Background(), bson.M{"_id": rootID}, update, opts).Decode(&root); err != nil {
 		return nil, err
 	}
-
-	message.ID = result.InsertedID.(primitive.ObjectID)
-	return message, nil
+	return &root, nil
 }
 
-// GetPrivateMessages 获取两个用户之间的私聊消息
-func GetPrivateMessages(userID1, userID2 string, limit, skip int64) ([]*Message, error) {
-	collection := MongoDatabase.Collection("messages")
+// GetThreadMessages 获取话题的回复，分页方式与会话消息一致
+func GetThreadMessages(rootID string, query *MessagePageQuery) (*MessagePage, error) {
+	return findMessagePage(bson.M{"threadId": rootID}, query)
+}
 
-	// 构建查询条件：(sender=userID1 AND receiver=userID2) OR (sender=userID2 AND receiver=userID1)
-	filter := bson.M{
-		"type": MessageTypePrivate,
+// GetMentions 获取@用户的群聊消息，包括@所有人的消息，只查询用户所在的群组
+func GetMentions(userID string, groupIDs []string, query *MessagePageQuery) (*MessagePage, error) {
+	return findMessagePage(bson.M{
+		"type":    MessageTypeGroup,
+		"groupId": bson.M{"$in": groupIDs},
 		"$or": []bson.M{
-			{
-				"senderId":   userID1,
-				"receiverId": userID2,
-			},
-			{
-				"senderId":   userID2,
-				"receiverId": userID1,
-			},
+			{"mentions": userID},
+			{"mentionAll": true},
 		},
+	}, query)
+}
+
+// updateQuotes 消息编辑或撤回后同步更新回复中保存的摘要
+func updateQuotes(message *Message) error {
+	quote := NewMessageQuote(message)
+
+	collection := MongoDatabase.Collection("messages")
+	_, err := collection.UpdateMany(context.Background(), bson.M{"replyTo.id": quote.ID}, bson.M{
+		"$set": bson.M{"replyTo.content": quote.Content, "replyTo.recalled": quote.Recalled},
+	})
+	return err
+}
+
+// 分页每页的默认和最大条数
+const (
+	DefaultMessagePageSize = 20
+	MaxMessagePageSize     = 100
+)
+
+// MessageCursor 消息分页游标，按时间戳排序，时间戳相同的消息按ID排序
+type MessageCursor struct {
+	Timestamp time.Time
+	ID        primitive.ObjectID
+}
+
+// NewMessageCursor 返回指向消息的游标
+func NewMessageCursor(message *Message) *MessageCursor {
+	return &MessageCursor{Timestamp: message.Timestamp, ID: message.ID}
+}
+
+// String 将游标编码为"毫秒时间戳_消息ID"
+func (c *MessageCursor) String() string {
+	return fmt.Sprintf("%d_%s", c.Timestamp.UnixMilli(), c.ID.Hex())
+}
+
+// Before 判断游标是否排在other之前，先比较时间戳，时间戳相同时比较ID
+func (c *MessageCursor) Before(other *MessageCursor) bool {
+	if !c.Timestamp.Equal(other.Timestamp) {
+		return c.Timestamp.Before(other.Timestamp)
+	}
+	return c.ID.Hex() < other.ID.Hex()
+}
+
+// ParseMessageCursor 解析String编码的游标
+func ParseMessageCursor(s string) (*MessageCursor, error) {
+	parts := strings.SplitN(s, "_", 2)
+	if len(parts) != 2 {
+		return nil, errors.New("无效的分页游标")
+	}
+
+	millis, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return nil, errors.New("无效的分页游标")
+	}
+	id, err := primitive.ObjectIDFromHex(parts[1])
+	if err != nil {
+		return nil, errors.New("无效的分页游标")
+	}
+
+	return &MessageCursor{Timestamp: time.UnixMilli(millis), ID: id}, nil
+}
+
+// MessagePageQuery 消息分页查询。只有Before时向更早的消息翻页，
+// 有After时向更新的消息翻页，两者都没有时返回最新的一页
+type MessagePageQuery struct {
+	Before *MessageCursor
+	After  *MessageCursor
+	Limit  int64
+}
+
+// MessagePage 一页消息，消息总是按时间升序排列
+type MessagePage struct {
+	Messages []*Message
+	// 翻页方向上是否还有更多消息
+	HasMore bool
+}
+
+// GetPrivateMessages 获取两个用户之间的私聊消息
+func GetPrivateMessages(userID1, userID2 string, query *MessagePageQuery) (*MessagePage, error) {
+	return findMessagePage(privateConversationFilter(userID1, userID2), query)
+}
+
+// GetGroupMessages 获取群组消息
+func GetGroupMessages(groupID string, query *MessagePageQuery) (*MessagePage, error) {
+	// 话题回复通过话题接口获取
+	return findMessagePage(bson.M{"type": MessageTypeGroup, "groupId": groupID, "threadId": bson.M{"$exists": false}}, query)
+}
+
+// findMessagePage 按(timestamp, _id)游标查询一页消息，多查一条用于判断是否还有更多
+func findMessagePage(filter bson.M, query *MessagePageQuery) (*MessagePage, error) {
+	conditions := []bson.M{filter}
+	if query.Before != nil {
+		conditions = append(conditions, cursorCondition("$lt", query.Before))
+	}
+	if query.After != nil {
+		conditions = append(conditions, cursorCondition("$gt", query.After))
+	}
+
+	// 向后翻页时升序查询，否则降序查询最新的消息再反转
+	ascending := query.After != nil
+	order := -1
+	if ascending {
+		order = 1
 	}
 
-	// 设置排序和分页
 	opts := options.Find().
-		SetSort(bson.D{{"timestamp", -1}}). // 按时间降序
-		SetLimit(limit).
-		SetSkip(skip)
+		SetSort(bson.D{{Key: "timestamp", Value: order}, {Key: "_id", Value: order}}).
+		SetLimit(query.Limit + 1)
 
-	cursor, err := collection.Find(context.Background(), filter, opts)
+	collection := MongoDatabase.Collection("messages")
+	cursor, err := collection.Find(context.Background(), bson.M{"$and": conditions}, opts)
 	if err != nil {
 		return nil, err
 	}
 	defer cursor.Close(context.Background())
 
-	var messages []*Message
+	messages := []*Message{}
 	if err = cursor.All(context.Background(), &messages); err != nil {
 		return nil, err
 	}
 
-	return messages, nil
+	page := &MessagePage{Messages: messages}
+	if int64(len(messages)) > query.Limit {
+		page.Messages = messages[:query.Limit]
+		page.HasMore = true
+	}
+
+	if !ascending {
+		for i, j := 0, len(page.Messages)-1; i < j; i, j = i+1, j-1 {
+			page.Messages[i], page.Messages[j] = page.Messages[j], page.Messages[i]
+		}
+	}
+
+	if err := attachReactions(page.Messages); err != nil {
+		return nil, err
+	}
+
+	return page, nil
 }
 
-// GetGroupMessages 获取群组消息
-func GetGroupMessages(groupID string, limit, skip int64) ([]*Message, error) {
+// GetGroupSendersBetween 获取群组中游标after之后、through之前（含）的消息发送者，
+// 不包括exceptUserID。after为nil时从第一条消息开始
+func GetGroupSendersBetween(groupID string, after, through *MessageCursor, exceptUserID string) ([]string, error) {
+	conditions := []bson.M{{"$or": []bson.M{
+		{"timestamp": bson.M{"$lt": through.Timestamp}},
+		{"timestamp": through.Timestamp, "_id": bson.M{"$lte": through.ID}},
+	}}}
+	if after != nil {
+		conditions = append(conditions, cursorCondition("$gt", after))
+	}
+	filter := bson.M{
+		"type":     MessageTypeGroup,
+		"groupId":  groupID,
+		"senderId": bson.M{"$ne": exceptUserID},
+		"$and":     conditions,
+	}
+
+	values, err := MongoDatabase.Collection("messages").Distinct(context.Background(), "senderId", filter)
+	if err != nil {
+		return nil, err
+	}
+
+	senders := make([]string, 0, len(values))
+	for _, value := range values {
+		if sender, ok := value.(string); ok {
+			senders = append(senders, sender)
+		}
+	}
+	return senders, nil
+}
+
+// cursorCondition 游标之前($lt)或之后($gt)的查询条件
+func cursorCondition(op string, c *MessageCursor) bson.M {
+	return timeCursorCondition("timestamp", op, c)
+}
+
+// timeCursorCondition 按(field, _id)排序时游标之前($lt)或之后($gt)的查询条件
+func timeCursorCondition(field, op string, c *MessageCursor) bson.M {
+	return bson.M{"$or": []bson.M{
+		{field: bson.M{op: c.Timestamp}},
+		{field: c.Timestamp, "_id": bson.M{op: c.ID}},
+	}}
+}
+
+// ensureMessageIndexes 建立会话消息分页使用的复合索引
+func ensureMessageIndexes() {
 	collection := MongoDatabase.Collection("messages")
+	_, err := collection.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+		{Keys: bson.D{
+			{Key: "type", Value: 1},
+			{Key: "senderId", Value: 1},
+			{Key: "receiverId", Value: 1},
+			{Key: "timestamp", Value: -1},
+			{Key: "_id", Value: -1},
+		}},
+		{Keys: bson.D{
+			{Key: "type", Value: 1},
+			{Key: "groupId", Value: 1},
+			{Key: "timestamp", Value: -1},
+			{Key: "_id", Value: -1},
+		}},
+		{Keys: bson.D{
+			{Key: "threadId", Value: 1},
+			{Key: "timestamp", Value: -1},
+			{Key: "_id", Value: -1},
+		}, Options: options.Index().SetSparse(true)},
+		{Keys: bson.D{{Key: "replyTo.id", Value: 1}}, Options: options.Index().SetSparse(true)},
+		{Keys: bson.D{
+			{Key: "mentions", Value: 1},
+			{Key: "timestamp", Value: -1},
+			{Key: "_id", Value: -1},
+		}, Options: options.Index().SetPartialFilterExpression(bson.M{"mentions": bson.M{"$exists": true}})},
+		{Keys: bson.D{
+			{Key: "groupId", Value: 1},
+			{Key: "timestamp", Value: -1},
+			{Key: "_id", Value: -1},
+		}, Options: options.Index().SetPartialFilterExpression(bson.M{"mentionAll": true})},
+	})
+	if err != nil {
+		log.Printf("创建消息索引失败: %v", err)
+	}
+}
 
-	// 构建查询条件
-	filter := bson.M{
-		"type":    MessageTypeGroup,
-		"groupId": groupID,
+// privateConversationFilter 两个用户之间私聊消息的查询条件
+func privateConversationFilter(userID1, userID2 string) bson.M {
+	return bson.M{
+		"type": MessageTypePrivate,
+		"$or": []bson.M{
+			{"senderId": userID1, "receiverId": userID2},
+			{"senderId": userID2, "receiverId": userID1},
+		},
+	}
+}
+
+// findMessagesAfter 查询游标之后的消息，按(timestamp, _id)升序。after为nil时从第一条消息开始
+func findMessagesAfter(filter bson.M, after *MessageCursor, limit int64) ([]*Message, error) {
+	if after != nil {
+		filter = bson.M{"$and": []bson.M{filter, cursorCondition("$gt", after)}}
 	}
 
-	// 设置排序和分页
 	opts := options.Find().
-		SetSort(bson.D{{"timestamp", 1}}). // 按时间降序
-		SetLimit(limit).
-		SetSkip(skip)
+		SetSort(bson.D{{Key: "timestamp", Value: 1}, {Key: "_id", Value: 1}}).
+		SetLimit(limit)
 
+	collection := MongoDatabase.Collection("messages")
 	cursor, err := collection.Find(context.Background(), filter, opts)
 	if err != nil {
 		return nil, err
@@ -138,18 +453,92 @@ func GetGroupMessages(groupID string, limit, skip int64) ([]*Message, error) {
 	return messages, nil
 }
 
-// MarkMessagesAsRead 将消息标记为已读
-func MarkMessagesAsRead(messageIDs []primitive.ObjectID) error {
+// GetPrivateMessagesAfter 获取两个用户之间游标之后的私聊消息，按时间升序
+func GetPrivateMessagesAfter(userID1, userID2 string, after *MessageCursor, limit int64) ([]*Message, error) {
+	return findMessagesAfter(privateConversationFilter(userID1, userID2), after, limit)
+}
+
+// GetGroupMessagesAfter 获取群组游标之后的消息，按时间升序
+func GetGroupMessagesAfter(groupID string, after *MessageCursor, limit int64) ([]*Message, error) {
+	return findMessagesAfter(bson.M{"type": MessageTypeGroup, "groupId": groupID}, after, limit)
+}
+
+// GetMessageByID 通过ID获取消息
+func GetMessageByID(id string) (*Message, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+
 	collection := MongoDatabase.Collection("messages")
+	var message Message
+	if err := collection.FindOne(context.Background(), bson.M{"_id": objectID}).Decode(&message); err != nil {
+		return nil, err
+	}
+	return &message, nil
+}
 
-	filter := bson.M{
-		"_id": bson.M{"$in": messageIDs},
+// EditMessage 修改消息内容，并把修改前的内容保存为历史版本。
+// 只有内容仍与读取时一致才会更新，并发编辑时返回ErrMessageChanged
+func EditMessage(message *Message, content string) (*Message, error) {
+	revisionTime := message.Timestamp
+	if message.EditedAt != nil {
+		revisionTime = *message.EditedAt
 	}
 
+	now := time.Now()
+	filter := bson.M{"_id": message.ID, "content": message.Content, "recalledAt": bson.M{"$exists": false}}
 	update := bson.M{
-		"$set": bson.M{"read": true},
+		"$set":  bson.M{"content": content, "editedAt": now, "searchTokens": searchTokens(content)},
+		"$push": bson.M{"revisions": MessageRevision{Content: message.Content, CreatedAt: revisionTime}},
 	}
 
-	_, err := collection.UpdateMany(context.Background(), filter, update)
-	return err
+	collection := MongoDatabase.Collection("messages")
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var updated Message
+	err := collection.FindOneAndUpdate(context.Background(), filter, update, opts).Decode(&updated)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrMessageChanged
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := updateQuotes(&updated); err != nil {
+		log.Printf("更新引用摘要失败: %v", err)
+	}
+	if err := updateConversationPreviews(&updated); err != nil {
+		log.Printf("更新会话列表失败: %v", err)
+	}
+	return &updated, nil
+}
+
+// RecallMessage 撤回消息，消息变为清空内容和编辑历史的占位记录
+func RecallMessage(id primitive.ObjectID, recalledBy string) (*Message, error) {
+	filter := bson.M{"_id": id, "recalledAt": bson.M{"$exists": false}}
+	update := bson.M{
+		"$set":   bson.M{"content": "", "recalledAt": time.Now(), "recalledBy": recalledBy, "searchTokens": []string{}},
+		"$unset": bson.M{"revisions": "", "call": ""},
+	}
+
+	collection := MongoDatabase.Collection("messages")
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var updated Message
+	err := collection.FindOneAndUpdate(context.Background(), filter, update, opts).Decode(&updated)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrMessageRecalled
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := updateQuotes(&updated); err != nil {
+		log.Printf("更新引用摘要失败: %v", err)
+	}
+	if err := updateConversationPreviews(&updated); err != nil {
+		log.Printf("更新会话列表失败: %v", err)
+	}
+	return &updated, nil
 }
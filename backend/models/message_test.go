@@ -0,0 +1,129 @@
+package models
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestMessageCursorRoundTrip(t *testing.T) {
+	id := primitive.NewObjectID()
+	// 游标只保留毫秒精度，与MongoDB中保存的时间戳一致
+	cursor := &MessageCursor{Timestamp: time.Date(2024, 3, 8, 15, 4, 5, 123456789, time.UTC), ID: id}
+
+	s := cursor.String()
+	if want := "1709910245123_" + id.Hex(); s != want {
+		t.Fatalf("String() = %q，期望 %q", s, want)
+	}
+
+	parsed, err := ParseMessageCursor(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !parsed.Timestamp.Equal(cursor.Timestamp.Truncate(time.Millisecond)) || parsed.ID != id {
+		t.Fatalf("解析结果 %v，期望 %v", parsed, cursor)
+	}
+	if parsed.String() != s {
+		t.Fatalf("重新编码为 %q，期望 %q", parsed.String(), s)
+	}
+}
+
+func TestParseMessageCursorInvalid(t *testing.T) {
+	id := primitive.NewObjectID().Hex()
+	for _, s := range []string{
+		"",
+		"1709910245123",
+		"abc_" + id,
+		"1709910245123_zzz",
+		"1709910245123_" + id + "_1",
+	} {
+		if _, err := ParseMessageCursor(s); err == nil {
+			t.Errorf("ParseMessageCursor(%q) 没有返回错误", s)
+		}
+	}
+}
+
+// matchCursorCondition 按MongoDB的语义判断消息是否满足cursorCondition生成的条件
+func matchCursorCondition(t *testing.T, condition bson.M, message *Message) bool {
+	t.Helper()
+
+	compare := func(field string, value interface{}) int {
+		switch field {
+		case "timestamp":
+			return message.Timestamp.Compare(value.(time.Time))
+		case "_id":
+			id := value.(primitive.ObjectID)
+			return bytes.Compare(message.ID[:], id[:])
+		}
+		t.Fatalf("未知的字段 %s", field)
+		return 0
+	}
+	match := func(field string, value interface{}) bool {
+		ops, ok := value.(bson.M)
+		if !ok {
+			return compare(field, value) == 0
+		}
+		for op, operand := range ops {
+			c := compare(field, operand)
+			if (op == "$lt" && c >= 0) || (op == "$gt" && c <= 0) {
+				return false
+			}
+		}
+		return true
+	}
+
+	for _, branch := range condition["$or"].([]bson.M) {
+		matched := true
+		for field, value := range branch {
+			matched = matched && match(field, value)
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+func TestCursorCondition(t *testing.T) {
+	base := time.UnixMilli(1709910245123)
+	newMessage := func(offset time.Duration, counter byte) *Message {
+		var id primitive.ObjectID
+		id[11] = counter
+		return &Message{ID: id, Timestamp: base.Add(offset)}
+	}
+
+	// 时间戳相同的消息按ID排序，游标指向中间一条
+	earlier := newMessage(-time.Millisecond, 9)
+	sameLow := newMessage(0, 1)
+	cursorMessage := newMessage(0, 2)
+	sameHigh := newMessage(0, 3)
+	later := newMessage(time.Millisecond, 0)
+	cursor := NewMessageCursor(cursorMessage)
+
+	tests := []struct {
+		name    string
+		message *Message
+		before  bool
+		after   bool
+	}{
+		{"更早的消息", earlier, true, false},
+		{"时间相同ID更小", sameLow, true, false},
+		{"游标本身", cursorMessage, false, false},
+		{"时间相同ID更大", sameHigh, false, true},
+		{"更晚的消息", later, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := matchCursorCondition(t, cursorCondition("$lt", cursor), tt.message); got != tt.before {
+				t.Errorf("$lt 匹配结果 %v，期望 %v", got, tt.before)
+			}
+			if got := matchCursorCondition(t, cursorCondition("$gt", cursor), tt.message); got != tt.after {
+				t.Errorf("$gt 匹配结果 %v，期望 %v", got, tt.after)
+			}
+		})
+	}
+}
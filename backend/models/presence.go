@@ -0,0 +1,91 @@
+package models
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// PresenceHeartbeatInterval 实例刷新在线记录的间隔
+	PresenceHeartbeatInterval = 30 * time.Second
+
+	// presenceSessionTTL 在线记录超过这个时间没有刷新时视为实例已退出，
+	// 例如实例崩溃时没有删除自己的记录
+	presenceSessionTTL = 4 * PresenceHeartbeatInterval
+)
+
+// PresenceSession MongoDB中用户在某个实例上在线的记录，多个实例共享，
+// 用户在所有实例上都没有记录时才标记为离线
+type PresenceSession struct {
+	UserID     string    `bson:"userId"`
+	InstanceID string    `bson:"instanceId"`
+	CreatedAt  time.Time `bson:"createdAt"`
+	UpdatedAt  time.Time `bson:"updatedAt"` // 实例最近一次心跳的时间
+}
+
+// ensurePresenceSessionIndexes 建立唯一索引，每个用户在每个实例上只有一条记录，
+// 并按心跳时间建立过期索引
+func ensurePresenceSessionIndexes() {
+	collection := MongoDatabase.Collection("presence_sessions")
+	_, err := collection.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "userId", Value: 1}, {Key: "instanceId", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "instanceId", Value: 1}}},
+		{Keys: bson.D{{Key: "updatedAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(int32(presenceSessionTTL.Seconds()))},
+	})
+	if err != nil {
+		log.Printf("创建在线记录索引失败: %v", err)
+	}
+}
+
+// AddPresenceSession 记录用户在实例上在线
+func AddPresenceSession(userID, instanceID string) error {
+	now := time.Now()
+	collection := MongoDatabase.Collection("presence_sessions")
+	_, err := collection.UpdateOne(context.Background(),
+		bson.M{"userId": userID, "instanceId": instanceID},
+		bson.M{
+			"$set":         bson.M{"updatedAt": now},
+			"$setOnInsert": bson.M{"createdAt": now},
+		},
+		options.Update().SetUpsert(true))
+	return err
+}
+
+// RemovePresenceSession 删除用户在实例上的在线记录，返回用户是否仍在其他实例上在线。
+// 过期索引不会立即删除记录，超过有效期没有心跳的记录同样不算在线
+func RemovePresenceSession(userID, instanceID string) (bool, error) {
+	collection := MongoDatabase.Collection("presence_sessions")
+	if _, err := collection.DeleteOne(context.Background(), bson.M{"userId": userID, "instanceId": instanceID}); err != nil {
+		return false, err
+	}
+
+	count, err := collection.CountDocuments(context.Background(), bson.M{
+		"userId":    userID,
+		"updatedAt": bson.M{"$gt": time.Now().Add(-presenceSessionTTL)},
+	}, options.Count().SetLimit(1))
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// TouchPresenceSessions 刷新实例上所有在线记录的心跳时间
+func TouchPresenceSessions(instanceID string) error {
+	collection := MongoDatabase.Collection("presence_sessions")
+	_, err := collection.UpdateMany(context.Background(), bson.M{"instanceId": instanceID}, bson.M{
+		"$set": bson.M{"updatedAt": time.Now()},
+	})
+	return err
+}
+
+// ClearPresenceSessions 删除实例的所有在线记录，实例启动和关闭时调用
+func ClearPresenceSessions(instanceID string) error {
+	collection := MongoDatabase.Collection("presence_sessions")
+	_, err := collection.DeleteMany(context.Background(), bson.M{"instanceId": instanceID})
+	return err
+}
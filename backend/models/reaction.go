@@ -0,0 +1,235 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrTooManyReactions 消息上不同表情的数量已达上限
+var ErrTooManyReactions = errors.New("该消息的表情回应种类已达上限")
+
+// Reaction MongoDB中的表情回应，每个用户对每条消息的每种表情一条记录，
+// 单独存储避免频繁改写消息文档
+type Reaction struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	MessageID primitive.ObjectID `bson:"messageId" json:"messageId"`
+	UserID    string             `bson:"userId" json:"userId"`
+	Emoji     string             `bson:"emoji" json:"emoji"`
+	CreatedAt time.Time          `bson:"createdAt" json:"createdAt"`
+}
+
+// ReactionSummary 消息上某种表情的回应汇总
+type ReactionSummary struct {
+	Emoji   string   `json:"emoji"`
+	Count   int      `json:"count"`
+	UserIDs []string `json:"userIds"` // 按回应时间升序
+}
+
+// ensureReactionIndexes 建立唯一索引，同一用户对同一消息的同一表情只能回应一次
+func ensureReactionIndexes() {
+	collection := MongoDatabase.Collection("message_reactions")
+	_, err := collection.Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "messageId", Value: 1},
+			{Key: "emoji", Value: 1},
+			{Key: "userId", Value: 1},
+		},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		log.Printf("创建表情回应索引失败: %v", err)
+	}
+}
+
+// reserveEmoji 在消息的表情集合中登记表情，集合记录在message_reaction_emojis中，每条消息一个文档。
+// 登记通过条件更新完成，并发添加不同的新表情时总数也不会超过maxEmojis
+func reserveEmoji(messageID primitive.ObjectID, emoji string, maxEmojis int) error {
+	collection := MongoDatabase.Collection("message_reaction_emojis")
+
+	// 第一次登记时用已有的表情回应初始化集合
+	count, err := collection.CountDocuments(context.Background(), bson.M{"_id": messageID}, options.Count().SetLimit(1))
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		emojis, err := MongoDatabase.Collection("message_reactions").Distinct(context.Background(), "emoji", bson.M{"messageId": messageID})
+		if err != nil {
+			return err
+		}
+		if emojis == nil {
+			emojis = []interface{}{}
+		}
+		_, err = collection.InsertOne(context.Background(), bson.M{"_id": messageID, "emojis": emojis})
+		if err != nil && !mongo.IsDuplicateKeyError(err) {
+			return err
+		}
+	}
+
+	filter := bson.M{"_id": messageID}
+	if maxEmojis > 0 {
+		// 表情已登记，或者集合中第maxEmojis个位置还空着
+		filter["$or"] = []bson.M{
+			{"emojis": emoji},
+			{fmt.Sprintf("emojis.%d", maxEmojis-1): bson.M{"$exists": false}},
+		}
+	}
+	result, err := collection.UpdateOne(context.Background(), filter, bson.M{"$addToSet": bson.M{"emojis": emoji}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount > 0 {
+		return nil
+	}
+
+	// 并发取消回应时集合可能漏记仍在使用的表情，以实际的回应为准
+	used, err := MongoDatabase.Collection("message_reactions").CountDocuments(context.Background(),
+		bson.M{"messageId": messageID, "emoji": emoji}, options.Count().SetLimit(1))
+	if err != nil {
+		return err
+	}
+	if used == 0 {
+		return ErrTooManyReactions
+	}
+	_, err = collection.UpdateOne(context.Background(), bson.M{"_id": messageID}, bson.M{"$addToSet": bson.M{"emojis": emoji}})
+	return err
+}
+
+// AddReaction 添加表情回应，返回是否有修改，已经回应过时不做修改。
+// 消息上已有maxEmojis种不同表情时不能再添加新的表情
+func AddReaction(messageID primitive.ObjectID, userID, emoji string, maxEmojis int) (bool, error) {
+	if err := reserveEmoji(messageID, emoji, maxEmojis); err != nil {
+		return false, err
+	}
+
+	collection := MongoDatabase.Collection("message_reactions")
+	reaction := &Reaction{
+		MessageID: messageID,
+		UserID:    userID,
+		Emoji:     emoji,
+		CreatedAt: time.Now(),
+	}
+	if _, err := collection.InsertOne(context.Background(), reaction); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// RemoveReaction 取消表情回应，返回是否有修改，没有回应过时不做修改。
+// 表情没有其他人使用时从消息的表情集合中移除
+func RemoveReaction(messageID primitive.ObjectID, userID, emoji string) (bool, error) {
+	collection := MongoDatabase.Collection("message_reactions")
+	result, err := collection.DeleteOne(context.Background(), bson.M{
+		"messageId": messageID,
+		"userId":    userID,
+		"emoji":     emoji,
+	})
+	if err != nil || result.DeletedCount == 0 {
+		return false, err
+	}
+
+	remaining, err := collection.CountDocuments(context.Background(),
+		bson.M{"messageId": messageID, "emoji": emoji}, options.Count().SetLimit(1))
+	if err != nil || remaining > 0 {
+		return true, err
+	}
+	_, err = MongoDatabase.Collection("message_reaction_emojis").UpdateOne(context.Background(),
+		bson.M{"_id": messageID}, bson.M{"$pull": bson.M{"emojis": emoji}})
+	return true, err
+}
+
+// DeleteMessageReactions 删除消息上的所有表情回应
+func DeleteMessageReactions(messageID primitive.ObjectID) error {
+	collection := MongoDatabase.Collection("message_reactions")
+	if _, err := collection.DeleteMany(context.Background(), bson.M{"messageId": messageID}); err != nil {
+		return err
+	}
+
+	_, err := MongoDatabase.Collection("message_reaction_emojis").DeleteOne(context.Background(), bson.M{"_id": messageID})
+	return err
+}
+
+// GetMessageReactions 获取单条消息的表情回应汇总
+func GetMessageReactions(messageID primitive.ObjectID) ([]*ReactionSummary, error) {
+	summaries, err := getReactionSummaries([]primitive.ObjectID{messageID})
+	if err != nil {
+		return nil, err
+	}
+	if summaries[messageID] == nil {
+		return []*ReactionSummary{}, nil
+	}
+	return summaries[messageID], nil
+}
+
+// getReactionSummaries 批量汇总消息的表情回应，每条消息的表情按首次回应时间排序
+func getReactionSummaries(messageIDs []primitive.ObjectID) (map[primitive.ObjectID][]*ReactionSummary, error) {
+	result := make(map[primitive.ObjectID][]*ReactionSummary)
+	if len(messageIDs) == 0 {
+		return result, nil
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"messageId": bson.M{"$in": messageIDs}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "createdAt", Value: 1}, {Key: "_id", Value: 1}}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":     bson.M{"messageId": "$messageId", "emoji": "$emoji"},
+			"userIds": bson.M{"$push": "$userId"},
+			"first":   bson.M{"$min": "$createdAt"},
+		}}},
+		{{Key: "$sort", Value: bson.D{{Key: "first", Value: 1}}}},
+	}
+
+	collection := MongoDatabase.Collection("message_reactions")
+	cursor, err := collection.Aggregate(context.Background(), pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	var groups []struct {
+		ID struct {
+			MessageID primitive.ObjectID `bson:"messageId"`
+			Emoji     string             `bson:"emoji"`
+		} `bson:"_id"`
+		UserIDs []string `bson:"userIds"`
+	}
+	if err := cursor.All(context.Background(), &groups); err != nil {
+		return nil, err
+	}
+
+	for _, g := range groups {
+		result[g.ID.MessageID] = append(result[g.ID.MessageID], &ReactionSummary{
+			Emoji:   g.ID.Emoji,
+			Count:   len(g.UserIDs),
+			UserIDs: g.UserIDs,
+		})
+	}
+	return result, nil
+}
+
+// attachReactions 为消息填充表情回应汇总
+func attachReactions(messages []*Message) error {
+	ids := make([]primitive.ObjectID, 0, len(messages))
+	for _, message := range messages {
+		ids = append(ids, message.ID)
+	}
+
+	summaries, err := getReactionSummaries(ids)
+	if err != nil {
+		return err
+	}
+	for _, message := range messages {
+		message.Reactions = summaries[message.ID]
+	}
+	return nil
+}
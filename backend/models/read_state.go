@@ -0,0 +1,137 @@
+package models
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ReadState MongoDB中用户在某个会话中的已读位置。
+// 已读位置之前（含）的消息都视为已读，只会向后移动
+type ReadState struct {
+	ID             primitive.ObjectID `bson:"_id,omitempty" json:"-"`
+	UserID         string             `bson:"userId" json:"userId"`
+	Type           string             `bson:"type" json:"type"`                     // private, group
+	ConversationID string             `bson:"conversationId" json:"conversationId"` // 私聊时为对方用户ID，群聊时为群组ID
+	LastReadID     primitive.ObjectID `bson:"lastReadId" json:"lastReadId"`
+	LastReadAt     time.Time          `bson:"lastReadAt" json:"lastReadAt"` // 最后已读消息的发送时间
+	UpdatedAt      time.Time          `bson:"updatedAt" json:"updatedAt"`
+}
+
+// Cursor 返回已读位置对应的消息游标
+func (s *ReadState) Cursor() *MessageCursor {
+	return &MessageCursor{Timestamp: s.LastReadAt, ID: s.LastReadID}
+}
+
+// HasRead 消息是否在已读位置之前（含）
+func (s *ReadState) HasRead(message *Message) bool {
+	if s.LastReadAt.Equal(message.Timestamp) {
+		return bytes.Compare(s.LastReadID[:], message.ID[:]) >= 0
+	}
+	return s.LastReadAt.After(message.Timestamp)
+}
+
+// ensureReadStateIndexes 建立唯一索引，每个用户在每个会话中只有一条已读位置
+func ensureReadStateIndexes() {
+	collection := MongoDatabase.Collection("read_states")
+	_, err := collection.Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "type", Value: 1},
+			{Key: "conversationId", Value: 1},
+			{Key: "userId", Value: 1},
+		},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		log.Printf("创建已读位置索引失败: %v", err)
+	}
+}
+
+// MarkRead 将用户在会话中的已读位置移动到消息处，返回是否发生了移动。
+// 已读位置已经在该消息之后时不做修改
+func MarkRead(userID, conversationType, conversationID string, message *Message) (bool, error) {
+	filter := bson.M{
+		"userId":         userID,
+		"type":           conversationType,
+		"conversationId": conversationID,
+		"$or": []bson.M{
+			{"lastReadAt": bson.M{"$lt": message.Timestamp}},
+			{"lastReadAt": message.Timestamp, "lastReadId": bson.M{"$lt": message.ID}},
+		},
+	}
+	update := bson.M{"$set": bson.M{
+		"lastReadId": message.ID,
+		"lastReadAt": message.Timestamp,
+		"updatedAt":  time.Now(),
+	}}
+
+	collection := MongoDatabase.Collection("read_states")
+	result, err := collection.UpdateOne(context.Background(), filter, update, options.Update().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		// 已有更新的已读位置，条件不匹配时upsert插入与唯一索引冲突
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if result.ModifiedCount == 0 && result.UpsertedCount == 0 {
+		return false, nil
+	}
+
+	state := &ReadState{LastReadID: message.ID, LastReadAt: message.Timestamp}
+	if err := refreshUnreadCount(userID, conversationType, conversationID, state); err != nil {
+		log.Printf("更新未读数失败: %v", err)
+	}
+	return true, nil
+}
+
+// GetReadState 获取用户在会话中的已读位置，没有读过时返回nil
+func GetReadState(userID, conversationType, conversationID string) (*ReadState, error) {
+	collection := MongoDatabase.Collection("read_states")
+
+	var state ReadState
+	err := collection.FindOne(context.Background(), bson.M{
+		"userId":         userID,
+		"type":           conversationType,
+		"conversationId": conversationID,
+	}).Decode(&state)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+// GetGroupReadStates 获取群组中已读到消息处的成员已读位置
+func GetGroupReadStates(groupID string, message *Message) ([]*ReadState, error) {
+	filter := bson.M{
+		"type":           MessageTypeGroup,
+		"conversationId": groupID,
+		"$or": []bson.M{
+			{"lastReadAt": bson.M{"$gt": message.Timestamp}},
+			{"lastReadAt": message.Timestamp, "lastReadId": bson.M{"$gte": message.ID}},
+		},
+	}
+
+	collection := MongoDatabase.Collection("read_states")
+	cursor, err := collection.Find(context.Background(), filter, options.Find().SetSort(bson.D{{Key: "updatedAt", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	states := []*ReadState{}
+	if err := cursor.All(context.Background(), &states); err != nil {
+		return nil, err
+	}
+	return states, nil
+}
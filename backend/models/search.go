@@ -0,0 +1,384 @@
+package models
+
+import (
+	"context"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// 分词和搜索的限制
+const (
+	maxTokenLength     = 64  // 单个英文单词保留的最大字符数
+	maxSearchTokens    = 32  // 单次搜索最多使用的词元数
+	searchSnippetWidth = 30  // 摘要中匹配位置前后保留的字符数
+	searchBackfillSize = 500 // 启动时每批补建索引的消息数
+)
+
+// MongoDB默认的文本索引按空格和标点分词，无法切分中文，
+// 因此消息保存时自行分词：中日韩文字按单字和相邻两字(bigram)切分，其他文字按单词切分，
+// 词元保存在消息的searchTokens字段上，通过普通的多键索引查询
+
+// isCJK 判断字符是否是需要按n-gram切分的中日韩文字
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
+}
+
+// splitRuns 将文本切分为连续的中日韩文字片段和单词，其他字符作为分隔符
+func splitRuns(text string) [][]rune {
+	var runs [][]rune
+	var current []rune
+	currentCJK := false
+
+	flush := func() {
+		if len(current) > 0 {
+			runs = append(runs, current)
+			current = nil
+		}
+	}
+
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case isCJK(r):
+			if !currentCJK {
+				flush()
+			}
+			currentCJK = true
+			current = append(current, r)
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if currentCJK {
+				flush()
+			}
+			currentCJK = false
+			current = append(current, r)
+		default:
+			flush()
+		}
+	}
+	flush()
+	return runs
+}
+
+// Tokenize 生成消息内容的索引词元：中日韩文字生成单字和bigram，其他文字生成小写单词
+func Tokenize(text string) []string {
+	var tokens []string
+	seen := make(map[string]bool)
+	add := func(token string) {
+		if !seen[token] {
+			seen[token] = true
+			tokens = append(tokens, token)
+		}
+	}
+
+	for _, run := range splitRuns(text) {
+		if !isCJK(run[0]) {
+			if len(run) > maxTokenLength {
+				run = run[:maxTokenLength]
+			}
+			add(string(run))
+			continue
+		}
+		for i := range run {
+			add(string(run[i]))
+			if i+1 < len(run) {
+				add(string(run[i : i+2]))
+			}
+		}
+	}
+	return tokens
+}
+
+// queryTokens 生成搜索词的查询词元：中日韩文字只有一个字时用单字，否则用bigram，
+// 所有词元都出现的消息才可能包含该搜索词
+func queryTokens(term string) []string {
+	var tokens []string
+	for _, run := range splitRuns(term) {
+		if !isCJK(run[0]) {
+			if len(run) > maxTokenLength {
+				run = run[:maxTokenLength]
+			}
+			tokens = append(tokens, string(run))
+			continue
+		}
+		if len(run) == 1 {
+			tokens = append(tokens, string(run))
+			continue
+		}
+		for i := 0; i+1 < len(run); i++ {
+			tokens = append(tokens, string(run[i:i+2]))
+		}
+	}
+	return tokens
+}
+
+// searchQueryPattern 匹配搜索语句中用双引号括起的短语和其他空白分隔的关键词
+var searchQueryPattern = regexp.MustCompile(`"([^"]*)"|(\S+)`)
+
+// SearchTerms 解析后的搜索语句，所有关键词和短语都必须匹配
+type SearchTerms struct {
+	Keywords []string
+	Phrases  []string // 用双引号括起的短语，必须连续出现
+}
+
+// ParseSearchTerms 解析搜索语句，例如：项目 "周五 上线"
+func ParseSearchTerms(q string) *SearchTerms {
+	terms := &SearchTerms{}
+	for _, match := range searchQueryPattern.FindAllStringSubmatch(q, -1) {
+		if phrase := strings.TrimSpace(match[1]); phrase != "" {
+			terms.Phrases = append(terms.Phrases, phrase)
+		} else if keyword := strings.Trim(match[2], `"`); keyword != "" {
+			terms.Keywords = append(terms.Keywords, keyword)
+		}
+	}
+	return terms
+}
+
+// Empty 是否没有可以搜索的内容
+func (t *SearchTerms) Empty() bool {
+	return len(t.tokens()) == 0
+}
+
+// tokens 返回所有搜索词的查询词元
+func (t *SearchTerms) tokens() []string {
+	var tokens []string
+	seen := make(map[string]bool)
+	for _, term := range append(append([]string{}, t.Keywords...), t.Phrases...) {
+		for _, token := range queryTokens(term) {
+			if !seen[token] && len(tokens) < maxSearchTokens {
+				seen[token] = true
+				tokens = append(tokens, token)
+			}
+		}
+	}
+	return tokens
+}
+
+// MessageSearchQuery 消息搜索条件。FriendIDs和GroupIDs是调用方有权访问的会话，
+// 搜索结果只包含这些会话中的消息
+type MessageSearchQuery struct {
+	UserID    string
+	FriendIDs []string
+	GroupIDs  []string
+	Terms     *SearchTerms
+	SenderID  string
+	From      *time.Time
+	To        *time.Time
+	Before    *MessageCursor
+	Limit     int64
+}
+
+// SearchMessages 搜索消息，按时间倒序返回，向更早的结果翻页时使用Before游标
+func SearchMessages(query *MessageSearchQuery) (*MessagePage, error) {
+	conditions := []bson.M{
+		{"searchTokens": bson.M{"$all": query.Terms.tokens()}},
+		{"$or": []bson.M{
+			{"type": MessageTypePrivate, "senderId": query.UserID, "receiverId": bson.M{"$in": query.FriendIDs}},
+			{"type": MessageTypePrivate, "senderId": bson.M{"$in": query.FriendIDs}, "receiverId": query.UserID},
+			{"type": MessageTypeGroup, "groupId": bson.M{"$in": query.GroupIDs}},
+		}},
+	}
+	// n-gram只能保证词元都出现，短语还需要按原文连续匹配
+	for _, phrase := range query.Terms.Phrases {
+		conditions = append(conditions, bson.M{"content": bson.M{"$regex": regexp.QuoteMeta(phrase), "$options": "i"}})
+	}
+	if query.SenderID != "" {
+		conditions = append(conditions, bson.M{"senderId": query.SenderID})
+	}
+	if query.From != nil {
+		conditions = append(conditions, bson.M{"timestamp": bson.M{"$gte": *query.From}})
+	}
+	if query.To != nil {
+		conditions = append(conditions, bson.M{"timestamp": bson.M{"$lt": *query.To}})
+	}
+	if query.Before != nil {
+		conditions = append(conditions, cursorCondition("$lt", query.Before))
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "timestamp", Value: -1}, {Key: "_id", Value: -1}}).
+		SetLimit(query.Limit + 1)
+
+	collection := MongoDatabase.Collection("messages")
+	cursor, err := collection.Find(context.Background(), bson.M{"$and": conditions}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	messages := []*Message{}
+	if err = cursor.All(context.Background(), &messages); err != nil {
+		return nil, err
+	}
+
+	page := &MessagePage{Messages: messages}
+	if int64(len(messages)) > query.Limit {
+		page.Messages = messages[:query.Limit]
+		page.HasMore = true
+	}
+	return page, nil
+}
+
+// SearchSnippet 搜索结果的摘要，Highlights是匹配内容在摘要中的[起始, 结束)字符位置
+type SearchSnippet struct {
+	Text       string   `json:"text"`
+	Highlights [][2]int `json:"highlights"`
+}
+
+// Highlight 生成消息内容中匹配搜索词的摘要，摘要截取第一个匹配位置前后的内容
+func Highlight(content string, terms *SearchTerms) *SearchSnippet {
+	text := []rune(content)
+	lower := []rune(strings.ToLower(content))
+	if len(lower) != len(text) {
+		// 大小写转换改变了字符数时退化为区分大小写匹配
+		lower = text
+	}
+
+	// 短语整体高亮，关键词按分词后的每个片段分别高亮
+	needles := append([]string{}, terms.Phrases...)
+	for _, keyword := range terms.Keywords {
+		for _, run := range splitRuns(keyword) {
+			needles = append(needles, string(run))
+		}
+	}
+
+	var ranges [][2]int
+	for _, needle := range needles {
+		n := []rune(strings.ToLower(needle))
+		for i := 0; len(n) > 0 && i+len(n) <= len(lower); i++ {
+			if string(lower[i:i+len(n)]) == string(n) {
+				ranges = append(ranges, [2]int{i, i + len(n)})
+				i += len(n) - 1
+			}
+		}
+	}
+	ranges = mergeRanges(ranges)
+
+	start, end := 0, len(text)
+	if len(ranges) > 0 {
+		if ranges[0][0] > searchSnippetWidth {
+			start = ranges[0][0] - searchSnippetWidth
+		}
+		if ranges[0][1]+searchSnippetWidth < end {
+			end = ranges[0][1] + searchSnippetWidth
+		}
+	} else if end > 2*searchSnippetWidth {
+		end = 2 * searchSnippetWidth
+	}
+
+	// 截断处加省略号，高亮位置相应后移
+	offset := 0
+	snippet := &SearchSnippet{Text: string(text[start:end]), Highlights: [][2]int{}}
+	if start > 0 {
+		snippet.Text = "…" + snippet.Text
+		offset = 1
+	}
+	if end < len(text) {
+		snippet.Text += "…"
+	}
+	for _, r := range ranges {
+		if r[0] < start || r[1] > end {
+			continue
+		}
+		snippet.Highlights = append(snippet.Highlights, [2]int{r[0] - start + offset, r[1] - start + offset})
+	}
+	return snippet
+}
+
+// mergeRanges 按起始位置排序并合并重叠的区间
+func mergeRanges(ranges [][2]int) [][2]int {
+	if len(ranges) < 2 {
+		return ranges
+	}
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i][0] < ranges[j][0] })
+
+	merged := [][2]int{ranges[0]}
+	for _, r := range ranges[1:] {
+		last := &merged[len(merged)-1]
+		if r[0] <= last[1] {
+			if r[1] > last[1] {
+				last[1] = r[1]
+			}
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+// searchTokens 返回保存到消息上的词元，没有词元时也保存为空数组，
+// 与搜索功能上线前没有该字段的历史消息区分开，补建时不会重复处理
+func searchTokens(content string) []string {
+	if tokens := Tokenize(content); tokens != nil {
+		return tokens
+	}
+	return []string{}
+}
+
+// ensureSearchIndexes 建立搜索词元的多键索引
+func ensureSearchIndexes() {
+	collection := MongoDatabase.Collection("messages")
+	_, err := collection.Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "searchTokens", Value: 1},
+			{Key: "timestamp", Value: -1},
+			{Key: "_id", Value: -1},
+		},
+	})
+	if err != nil {
+		log.Printf("创建搜索索引失败: %v", err)
+	}
+}
+
+// backfillSearchTokens 为搜索功能上线前保存的消息生成词元
+func backfillSearchTokens() {
+	collection := MongoDatabase.Collection("messages")
+	filter := bson.M{
+		"searchTokens": bson.M{"$exists": false},
+		"recalledAt":   bson.M{"$exists": false},
+		"content":      bson.M{"$ne": ""},
+	}
+	opts := options.Find().
+		SetProjection(bson.M{"content": 1}).
+		SetLimit(searchBackfillSize)
+
+	total := 0
+	for {
+		cursor, err := collection.Find(context.Background(), filter, opts)
+		if err != nil {
+			log.Printf("补建搜索词元失败: %v", err)
+			return
+		}
+		var messages []*Message
+		err = cursor.All(context.Background(), &messages)
+		if err != nil {
+			log.Printf("补建搜索词元失败: %v", err)
+			return
+		}
+		if len(messages) == 0 {
+			break
+		}
+
+		writes := make([]mongo.WriteModel, 0, len(messages))
+		for _, message := range messages {
+			writes = append(writes, mongo.NewUpdateOneModel().
+				SetFilter(bson.M{"_id": message.ID}).
+				SetUpdate(bson.M{"$set": bson.M{"searchTokens": searchTokens(message.Content)}}))
+		}
+		if _, err := collection.BulkWrite(context.Background(), writes, options.BulkWrite().SetOrdered(false)); err != nil {
+			log.Printf("补建搜索词元失败: %v", err)
+			return
+		}
+		total += len(messages)
+	}
+
+	if total > 0 {
+		log.Printf("已为 %d 条历史消息补建搜索词元", total)
+	}
+}
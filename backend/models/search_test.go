@@ -0,0 +1,150 @@
+package models
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{"英文单词转小写", "Hello, World!", []string{"hello", "world"}},
+		{"中文单字和bigram", "项目上线", []string{"项", "项目", "目", "目上", "上", "上线", "线"}},
+		{"中英混排", "明天release v2版本", []string{"明", "明天", "天", "release", "v2", "版", "版本", "本"}},
+		{"中文后紧跟英文", "Go语言", []string{"go", "语", "语言", "言"}},
+		{"重复词元只保留一次", "好好 go GO", []string{"好", "好好", "go"}},
+		{"标点作为分隔符", "don't stop", []string{"don", "t", "stop"}},
+		{"超长单词截断", strings.Repeat("a", maxTokenLength+10), []string{strings.Repeat("a", maxTokenLength)}},
+		{"空文本", "  ，。", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Tokenize(tt.text); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("Tokenize(%q) = %q，期望 %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueryTokens(t *testing.T) {
+	tests := []struct {
+		name string
+		term string
+		want []string
+	}{
+		{"单个汉字", "中", []string{"中"}},
+		{"多个汉字只用bigram", "项目上线", []string{"项目", "目上", "上线"}},
+		{"中英混排", "明天release v2版本", []string{"明天", "release", "v2", "版本"}},
+		{"中文后紧跟英文", "Go语言", []string{"go", "语言"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := queryTokens(tt.term)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("queryTokens(%q) = %q，期望 %q", tt.term, got, tt.want)
+			}
+
+			// 查询词元必须都是同一文本的索引词元，否则搜索不到自己
+			indexed := make(map[string]bool)
+			for _, token := range Tokenize(tt.term) {
+				indexed[token] = true
+			}
+			for _, token := range got {
+				if !indexed[token] {
+					t.Fatalf("查询词元 %q 不在 %q 的索引词元中", token, tt.term)
+				}
+			}
+		})
+	}
+}
+
+func TestParseSearchTerms(t *testing.T) {
+	tests := []struct {
+		name string
+		q    string
+		want SearchTerms
+	}{
+		{"关键词和短语", `项目 "周五 上线"`, SearchTerms{Keywords: []string{"项目"}, Phrases: []string{"周五 上线"}}},
+		{"多个空白", "a  b", SearchTerms{Keywords: []string{"a", "b"}}},
+		{"空短语忽略", `""`, SearchTerms{}},
+		{"未闭合的引号按关键词处理", `"unclosed phrase`, SearchTerms{Keywords: []string{"unclosed", "phrase"}}},
+		{"短语去掉首尾空白", `" 周五 "`, SearchTerms{Phrases: []string{"周五"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParseSearchTerms(tt.q); !reflect.DeepEqual(*got, tt.want) {
+				t.Fatalf("ParseSearchTerms(%q) = %+v，期望 %+v", tt.q, *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	padding := strings.Repeat("很", searchSnippetWidth)
+
+	tests := []struct {
+		name    string
+		content string
+		q       string
+		want    SearchSnippet
+	}{
+		{
+			name:    "英文不区分大小写，所有匹配都高亮",
+			content: "Hello World hello",
+			q:       "hello",
+			want:    SearchSnippet{Text: "Hello World hello", Highlights: [][2]int{{0, 5}, {12, 17}}},
+		},
+		{
+			name:    "中英混排的关键词相邻片段合并",
+			content: "Go语言很好",
+			q:       "go语言",
+			want:    SearchSnippet{Text: "Go语言很好", Highlights: [][2]int{{0, 4}}},
+		},
+		{
+			name:    "短语整体高亮",
+			content: "周五 上线 of the project",
+			q:       `"周五 上线"`,
+			want:    SearchSnippet{Text: "周五 上线 of the project", Highlights: [][2]int{{0, 5}}},
+		},
+		{
+			name:    "短语不连续出现时不高亮",
+			content: "项目周五上线",
+			q:       `"周五 上线"`,
+			want:    SearchSnippet{Text: "项目周五上线", Highlights: [][2]int{}},
+		},
+		{
+			name:    "两端截断时高亮位置后移一个省略号",
+			content: strings.Repeat("前", 10) + padding + "项目" + padding + strings.Repeat("后", 10),
+			q:       "项目",
+			want:    SearchSnippet{Text: "…" + padding + "项目" + padding + "…", Highlights: [][2]int{{31, 33}}},
+		},
+		{
+			name:    "摘要之外的匹配不高亮",
+			content: "项目" + padding + padding + "项目",
+			q:       "项目",
+			want:    SearchSnippet{Text: "项目" + padding + "…", Highlights: [][2]int{{0, 2}}},
+		},
+		{
+			name:    "没有匹配时截取开头",
+			content: padding + padding + "尾部",
+			q:       "zzz",
+			want:    SearchSnippet{Text: padding + padding + "…", Highlights: [][2]int{}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Highlight(tt.content, ParseSearchTerms(tt.q))
+			if !reflect.DeepEqual(*got, tt.want) {
+				t.Fatalf("Highlight(%q, %q) = %+v，期望 %+v", tt.content, tt.q, *got, tt.want)
+			}
+		})
+	}
+}
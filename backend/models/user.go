@@ -8,20 +8,22 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 	"golang.org/x/crypto/bcrypt"
 )
 
 // User MongoDB中的用户模型
 type User struct {
-	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
-	Username  string             `bson:"username" json:"username"`
-	Password  string             `bson:"password" json:"-"`
-	Email     string             `bson:"email" json:"email"`
-	Avatar    string             `bson:"avatar" json:"avatar"`
-	Status    string             `bson:"status" json:"status"` // online, offline, away
-	CreatedAt time.Time          `bson:"createdAt" json:"createdAt"`
-	UpdatedAt time.Time          `bson:"updatedAt" json:"updatedAt"`
-	Deleted   bool               `bson:"deleted" json:"-"`
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Username   string             `bson:"username" json:"username"`
+	Password   string             `bson:"password" json:"-"`
+	Email      string             `bson:"email" json:"email"`
+	Avatar     string             `bson:"avatar" json:"avatar"`
+	Status     string             `bson:"status" json:"status"`         // online, offline, away
+	LastSeenAt time.Time          `bson:"lastSeenAt" json:"lastSeenAt"` // 最近一次连接或断开的时间
+	CreatedAt  time.Time          `bson:"createdAt" json:"createdAt"`
+	UpdatedAt  time.Time          `bson:"updatedAt" json:"updatedAt"`
+	Deleted    bool               `bson:"deleted" json:"-"`
 }
 
 // Friendship MongoDB中的好友关系模型
@@ -109,6 +111,50 @@ func GetUserByID(id string) (*User, error) {
 	return &user, nil
 }
 
+// GetUsersByIDs 通过ID批量获取用户，只返回ID、用户名和头像，无效的ID被忽略
+func GetUsersByIDs(ids []string) ([]*User, error) {
+	objectIDs := make([]primitive.ObjectID, 0, len(ids))
+	for _, id := range ids {
+		if objectID, err := primitive.ObjectIDFromHex(id); err == nil {
+			objectIDs = append(objectIDs, objectID)
+		}
+	}
+	if len(objectIDs) == 0 {
+		return nil, nil
+	}
+
+	collection := MongoDatabase.Collection("users")
+	opts := options.Find().SetProjection(bson.M{"_id": 1, "username": 1, "avatar": 1})
+	cursor, err := collection.Find(context.Background(), bson.M{"_id": bson.M{"$in": objectIDs}, "deleted": false}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	var users []*User
+	if err = cursor.All(context.Background(), &users); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// GetUsersByUsernames 通过用户名批量获取用户，只返回ID和用户名
+func GetUsersByUsernames(usernames []string) ([]*User, error) {
+	collection := MongoDatabase.Collection("users")
+	opts := options.Find().SetProjection(bson.M{"_id": 1, "username": 1})
+	cursor, err := collection.Find(context.Background(), bson.M{"username": bson.M{"$in": usernames}, "deleted": false}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	var users []*User
+	if err = cursor.All(context.Background(), &users); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
 // GetUserByUsername 通过用户名获取用户
 func GetUserByUsername(username string) (*User, error) {
 	collection := MongoDatabase.Collection("users")
@@ -121,20 +167,51 @@ func GetUserByUsername(username string) (*User, error) {
 	return &user, nil
 }
 
-// UpdateUser 更新用户信息
-func UpdateUser(user *User) error {
-	user.UpdatedAt = time.Now()
+// UpdateUser 更新用户的指定字段。只写入修改的字段，
+// 不会覆盖同时由其他请求更新的在线状态等字段
+func UpdateUser(id primitive.ObjectID, fields bson.M) error {
+	update := bson.M{"updatedAt": time.Now()}
+	for key, value := range fields {
+		update[key] = value
+	}
 
 	collection := MongoDatabase.Collection("users")
 	_, err := collection.UpdateOne(
 		context.Background(),
-		bson.M{"_id": user.ID},
-		bson.M{"$set": user},
+		bson.M{"_id": id},
+		bson.M{"$set": update},
 	)
 
 	return err
 }
 
+// UpdateUserPresence 更新用户在线状态和最近在线时间，返回是否已更新。
+// 已有更晚的状态变化时不修改，多个实例的写入到达顺序不同也不会被旧状态覆盖
+func UpdateUserPresence(id, status string, lastSeenAt time.Time) (bool, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return false, err
+	}
+
+	collection := MongoDatabase.Collection("users")
+	result, err := collection.UpdateOne(
+		context.Background(),
+		bson.M{
+			"_id": objectID,
+			"$or": []bson.M{
+				{"lastSeenAt": bson.M{"$exists": false}},
+				{"lastSeenAt": bson.M{"$lte": lastSeenAt}},
+			},
+		},
+		bson.M{"$set": bson.M{"status": status, "lastSeenAt": lastSeenAt}},
+	)
+	if err != nil {
+		return false, err
+	}
+
+	return result.MatchedCount > 0, nil
+}
+
 // AddFriend 添加好友请求
 func AddFriend(userID, friendID string) (*Friendship, error) {
 	// 检查用户和好友是否存在
@@ -0,0 +1,76 @@
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrWSTicketInvalid 票据不存在、已使用或已过期
+var ErrWSTicketInvalid = errors.New("票据无效或已过期")
+
+// WSTicket MongoDB中的WebSocket连接票据，一次性使用，多个实例共享
+type WSTicket struct {
+	ID        string    `bson:"_id" json:"ticket"`
+	UserID    string    `bson:"userId" json:"-"`
+	ExpiresAt time.Time `bson:"expiresAt" json:"expiresAt"`
+}
+
+// ensureWSTicketIndexes 建立过期索引，清理未使用的票据
+func ensureWSTicketIndexes() {
+	collection := MongoDatabase.Collection("ws_tickets")
+	_, err := collection.Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		log.Printf("创建票据索引失败: %v", err)
+	}
+}
+
+// CreateWSTicket 为用户签发WebSocket连接票据
+func CreateWSTicket(userID string, ttl time.Duration) (*WSTicket, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+
+	ticket := &WSTicket{
+		ID:        hex.EncodeToString(buf),
+		UserID:    userID,
+		ExpiresAt: time.Now().Add(ttl),
+	}
+
+	collection := MongoDatabase.Collection("ws_tickets")
+	if _, err := collection.InsertOne(context.Background(), ticket); err != nil {
+		return nil, err
+	}
+	return ticket, nil
+}
+
+// ConsumeWSTicket 使用票据并返回绑定的用户ID，票据在查询的同时被删除，只能使用一次
+func ConsumeWSTicket(ticket string) (string, error) {
+	if ticket == "" {
+		return "", ErrWSTicketInvalid
+	}
+
+	collection := MongoDatabase.Collection("ws_tickets")
+	filter := bson.M{"_id": ticket, "expiresAt": bson.M{"$gt": time.Now()}}
+
+	var result WSTicket
+	err := collection.FindOneAndDelete(context.Background(), filter).Decode(&result)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return "", ErrWSTicketInvalid
+	}
+	if err != nil {
+		return "", err
+	}
+	return result.UserID, nil
+}
@@ -0,0 +1,116 @@
+package websocket
+
+import (
+	"log"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// ClientInfo 管理接口展示的连接信息
+type ClientInfo struct {
+	ID            string    `json:"id"`
+	UserID        string    `json:"userId"`
+	Transport     string    `json:"transport"`
+	ConnectedAt   time.Time `json:"connectedAt"`
+	RemoteAddr    string    `json:"remoteAddr"`
+	UserAgent     string    `json:"userAgent"`
+	QueueDepth    int       `json:"queueDepth"`
+	QueueCapacity int       `json:"queueCapacity"`
+	Dropped       uint64    `json:"dropped"`
+	LastPongAt    time.Time `json:"lastPongAt"`
+	Rooms         int       `json:"rooms"`
+}
+
+// touch 记录客户端最近一次活跃的时间
+func (c *Client) touch() {
+	atomic.StoreInt64(&c.lastPong, time.Now().UnixNano())
+}
+
+// isKicked 客户端是否被管理员强制断开
+func (c *Client) isKicked() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.kicked
+}
+
+// ID 返回实例ID，管理接口只能看到本实例的连接
+func (h *Hub) ID() string {
+	return h.id
+}
+
+// Clients 返回本实例的连接信息，userID不为空时只返回该用户的连接，按连接时间排序
+func (h *Hub) Clients(userID string) []*ClientInfo {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	clients := h.clients
+	if userID != "" {
+		clients = h.userClients[userID]
+	}
+
+	infos := make([]*ClientInfo, 0, len(clients))
+	for client := range clients {
+		infos = append(infos, &ClientInfo{
+			ID:            client.ID,
+			UserID:        client.UserID,
+			Transport:     client.Transport,
+			ConnectedAt:   client.ConnectedAt,
+			RemoteAddr:    client.RemoteAddr,
+			UserAgent:     client.UserAgent,
+			QueueDepth:    len(client.Send),
+			QueueCapacity: cap(client.Send),
+			Dropped:       atomic.LoadUint64(&client.dropped),
+			LastPongAt:    time.Unix(0, atomic.LoadInt64(&client.lastPong)),
+			Rooms:         len(client.rooms),
+		})
+	}
+
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ConnectedAt.Before(infos[j].ConnectedAt) })
+	return infos
+}
+
+// DisconnectClient 强制断开指定连接，连接可能在任意实例上。返回本实例是否找到该连接
+func (h *Hub) DisconnectClient(clientID string) bool {
+	found := h.kickLocal("", clientID) > 0
+	h.publish(&BrokerMessage{Kind: brokerKindKick, Client: clientID})
+	return found
+}
+
+// DisconnectUser 强制断开用户在所有实例上的连接，例如修改密码后。返回本实例断开的连接数
+func (h *Hub) DisconnectUser(userID string) int {
+	count := h.kickLocal(userID, "")
+	h.publish(&BrokerMessage{Kind: brokerKindKick, UserID: userID})
+	return count
+}
+
+// kickLocal 断开本实例上的连接，按用户ID或连接ID匹配
+func (h *Hub) kickLocal(userID, clientID string) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var targets []*Client
+	if userID != "" {
+		for client := range h.userClients[userID] {
+			targets = append(targets, client)
+		}
+	} else {
+		for client := range h.clients {
+			if client.ID == clientID {
+				targets = append(targets, client)
+				break
+			}
+		}
+	}
+
+	for _, client := range targets {
+		client.mu.Lock()
+		client.kicked = true
+		client.mu.Unlock()
+
+		// 关闭发送通道，写协程发送关闭帧后断开连接
+		h.removeClient(client)
+		log.Printf("Client disconnected by admin: %s (%s)", client.UserID, client.ID)
+	}
+	return len(targets)
+}
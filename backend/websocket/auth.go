@@ -0,0 +1,88 @@
+package websocket
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// FrameAuth 未携带票据的连接必须发送的第一条消息
+const FrameAuth = "auth"
+
+// 等待认证消息的最长时间
+const authTimeout = 10 * time.Second
+
+// Authenticator 校验认证消息的内容并返回用户ID，返回*Error时原样回复给客户端
+type Authenticator func(payload json.RawMessage) (string, error)
+
+// SetAuthenticator 设置认证消息的校验函数，未设置时只接受已认证的升级请求。必须在Run之前调用
+func (h *Hub) SetAuthenticator(auth Authenticator) {
+	h.authenticator = auth
+}
+
+// authenticate 读取连接的第一条消息完成认证，失败时回复错误帧并关闭连接
+func (h *Hub) authenticate(ws *websocket.Conn, format string) (string, bool) {
+	ws.SetReadLimit(h.connOptions.maxMessageSize)
+	ws.SetReadDeadline(time.Now().Add(authTimeout))
+
+	msgType, data, err := ws.ReadMessage()
+	if err != nil {
+		ws.Close()
+		return "", false
+	}
+	if data, err = decodeInbound(msgType, data); err != nil {
+		h.rejectAuth(ws, format, "", NewError(http.StatusBadRequest, "消息格式无效"))
+		return "", false
+	}
+
+	var env Envelope
+	if err := json.Unmarshal(data, &env); err != nil || env.V != ProtocolVersion || env.Type != FrameAuth {
+		h.rejectAuth(ws, format, env.ID, NewError(http.StatusUnauthorized, "请先发送认证消息"))
+		return "", false
+	}
+
+	userID, err := h.authenticator(env.Payload)
+	if err != nil {
+		var e *Error
+		if !errors.As(err, &e) {
+			log.Printf("WebSocket认证失败: %v", err)
+			e = NewError(http.StatusInternalServerError, "服务器错误")
+		}
+		h.rejectAuth(ws, format, env.ID, e)
+		return "", false
+	}
+
+	reply, err := encodeReply(env.ID, FrameAck, map[string]string{"userId": userID})
+	if err != nil {
+		ws.Close()
+		return "", false
+	}
+	ack, err := newFrame(reply).Encode(format)
+	if err != nil {
+		ws.Close()
+		return "", false
+	}
+
+	ws.SetWriteDeadline(time.Now().Add(h.connOptions.writeWait))
+	if err := ws.WriteMessage(messageType(format), ack); err != nil {
+		ws.Close()
+		return "", false
+	}
+	return userID, true
+}
+
+// rejectAuth 回复认证错误并关闭连接
+func (h *Hub) rejectAuth(ws *websocket.Conn, format, id string, e *Error) {
+	ws.SetWriteDeadline(time.Now().Add(h.connOptions.writeWait))
+	if reply, err := encodeReply(id, FrameError, e); err == nil {
+		if data, err := newFrame(reply).Encode(format); err == nil {
+			ws.WriteMessage(messageType(format), data)
+		}
+	}
+	ws.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "unauthorized"))
+	ws.Close()
+}
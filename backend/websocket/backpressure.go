@@ -0,0 +1,216 @@
+package websocket
+
+import (
+	"encoding/json"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/yourusername/gin-vue-chat/config"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// 慢消费者策略：客户端发送缓冲区已满时如何处理新消息
+const (
+	PolicyDisconnect = "disconnect"  // 断开连接，客户端重连后重放待确认事件
+	PolicyDropOldest = "drop_oldest" // 丢弃缓冲区中最早的消息
+	PolicyDropNewest = "drop_newest" // 丢弃新消息
+	PolicySpill      = "spill"       // 写入待确认存储，缓冲区清空后重放
+)
+
+// 默认的客户端发送缓冲区大小
+const defaultSendBufferSize = 256
+
+// hubCounters 慢消费者计数
+type hubCounters struct {
+	dropped      uint64 // 丢弃的帧数
+	spilled      uint64 // 写入待确认存储的帧数
+	disconnected uint64 // 因缓冲区满被断开的连接数
+}
+
+// ClientStats 单个连接的发送状态
+type ClientStats struct {
+	UserID     string `json:"userId"`
+	Transport  string `json:"transport"`
+	QueueDepth int    `json:"queueDepth"`
+	Dropped    uint64 `json:"dropped"`
+}
+
+// HubStats Hub的连接和慢消费者统计
+type HubStats struct {
+	Policy       string         `json:"policy"`
+	Clients      int            `json:"clients"`
+	Users        int            `json:"users"`
+	Dropped      uint64         `json:"dropped"`
+	Spilled      uint64         `json:"spilled"`
+	Disconnected uint64         `json:"disconnected"`
+	Lagging      []*ClientStats `json:"lagging"` // 发生过丢帧或缓冲区非空的连接
+}
+
+// slowConsumerPolicy 读取配置的慢消费者策略
+func slowConsumerPolicy() string {
+	policy := config.AppConfig.WebSocket.SlowConsumerPolicy
+	switch policy {
+	case PolicyDisconnect, PolicyDropOldest, PolicyDropNewest, PolicySpill:
+		return policy
+	case "":
+		return PolicyDisconnect
+	default:
+		log.Printf("未知的慢消费者策略 %q，使用 %s", policy, PolicyDisconnect)
+		return PolicyDisconnect
+	}
+}
+
+// sendBufferSize 读取配置的客户端发送缓冲区大小
+func sendBufferSize() int {
+	if size := config.AppConfig.WebSocket.SendBufferSize; size > 0 {
+		return size
+	}
+	return defaultSendBufferSize
+}
+
+// enqueue 把消息放入客户端发送缓冲区，缓冲区已满时按慢消费者策略处理。
+// 调用方必须持有hub的锁（读锁即可），保证客户端仍然注册、通道未关闭
+func (h *Hub) enqueue(client *Client, message *Frame) bool {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	// 重放完成前暂存实时消息，保证它们排在重放的事件之后
+	if client.replaying {
+		if len(client.held) >= h.sendBufferSize {
+			h.countDropped(client)
+			return false
+		}
+		client.held = append(client.held, message)
+		return true
+	}
+
+	return h.enqueueLocked(client, message)
+}
+
+// enqueueLocked 与enqueue相同，调用方必须持有客户端的锁
+func (h *Hub) enqueueLocked(client *Client, message *Frame) bool {
+	select {
+	case client.Send <- message:
+		return true
+	default:
+	}
+
+	if client.closing {
+		return false
+	}
+
+	// 优先事件已在待确认存储中，不丢弃，等缓冲区清空后重放
+	if message.priority && (h.policy == PolicyDropNewest || h.policy == PolicyDropOldest) {
+		h.spill(client, message)
+		return false
+	}
+
+	switch h.policy {
+	case PolicyDropNewest:
+		h.countDropped(client)
+		return false
+
+	case PolicyDropOldest:
+		select {
+		case <-client.Send:
+			h.countDropped(client)
+		default:
+		}
+		select {
+		case client.Send <- message:
+			return true
+		default:
+			h.countDropped(client)
+			return false
+		}
+
+	case PolicySpill:
+		h.spill(client, message)
+		return false
+
+	default:
+		// 断开连接，未确认的事件在重连后重放
+		client.closing = true
+		atomic.AddUint64(&h.counters.disconnected, 1)
+		h.countDropped(client)
+		log.Printf("客户端发送缓冲区已满，断开连接: %s", client.UserID)
+		go h.unregisterClient(client)
+		return false
+	}
+}
+
+// countDropped 记录丢弃的帧
+func (h *Hub) countDropped(client *Client) {
+	atomic.AddUint64(&client.dropped, 1)
+	atomic.AddUint64(&h.counters.dropped, 1)
+}
+
+// spill 把消息写入待确认存储，客户端缓冲区清空后由writePump触发重放。
+// 带ID的事件在发送前已经写入存储，请求回复无法重放只能丢弃
+func (h *Hub) spill(client *Client, message *Frame) {
+	var env Envelope
+	if err := json.Unmarshal(message.JSON(), &env); err != nil || env.Type == FrameAck || env.Type == FrameError {
+		h.countDropped(client)
+		return
+	}
+
+	atomic.AddUint64(&h.counters.spilled, 1)
+	client.spilled = true
+	if env.ID != "" {
+		return
+	}
+
+	// ObjectID在这里同步生成，异步写入也能保持重放顺序
+	env.ID = primitive.NewObjectID().Hex()
+	data, err := json.Marshal(env)
+	if err != nil {
+		h.countDropped(client)
+		return
+	}
+
+	event := &PendingEvent{ID: env.ID, UserID: client.UserID, Data: data, CreatedAt: time.Now()}
+	go func() {
+		if err := h.pending.Push(event); err != nil {
+			log.Printf("保存溢出事件失败 (%s): %v", client.UserID, err)
+		}
+	}()
+}
+
+// drained 发送缓冲区清空后调用，如有溢出的事件则开始重放
+func (c *Client) drained() {
+	c.mu.Lock()
+	spilled := c.spilled
+	c.spilled = false
+	c.mu.Unlock()
+
+	if spilled {
+		go c.Hub.replayPending(c)
+	}
+}
+
+// Stats 返回连接和慢消费者统计
+func (h *Hub) Stats() *HubStats {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	stats := &HubStats{
+		Policy:       h.policy,
+		Clients:      len(h.clients),
+		Users:        len(h.userClients),
+		Dropped:      atomic.LoadUint64(&h.counters.dropped),
+		Spilled:      atomic.LoadUint64(&h.counters.spilled),
+		Disconnected: atomic.LoadUint64(&h.counters.disconnected),
+		Lagging:      []*ClientStats{},
+	}
+
+	for client := range h.clients {
+		dropped := atomic.LoadUint64(&client.dropped)
+		depth := len(client.Send)
+		if dropped > 0 || depth > 0 {
+			stats.Lagging = append(stats.Lagging, &ClientStats{UserID: client.UserID, Transport: client.Transport, QueueDepth: depth, Dropped: dropped})
+		}
+	}
+
+	return stats
+}
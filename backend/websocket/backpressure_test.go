@@ -0,0 +1,47 @@
+package websocket
+
+import (
+	"sync/atomic"
+	"testing"
+)
+
+func TestPriorityEventsNotDropped(t *testing.T) {
+	for _, policy := range []string{PolicyDropNewest, PolicyDropOldest} {
+		t.Run(policy, func(t *testing.T) {
+			store := NewMemoryPendingStore()
+			hub := NewHub()
+			hub.policy = policy
+			hub.SetPendingStore(store)
+			go hub.Run()
+
+			alice := newTestClient(t, hub, "alice")
+			for len(alice.Send) < cap(alice.Send) {
+				alice.Send <- newFrame([]byte("filler"))
+			}
+
+			// 普通事件按策略丢弃
+			if err := hub.DeliverRef("m1", []string{"alice"}, "group", "normal"); err != nil {
+				t.Fatal(err)
+			}
+			if atomic.LoadUint64(&hub.counters.dropped) != 1 {
+				t.Fatalf("普通事件应被丢弃，丢弃计数 %d", hub.counters.dropped)
+			}
+
+			// 优先事件不丢弃，留在存储中等待重放
+			dropped := atomic.LoadUint64(&hub.counters.dropped)
+			if err := hub.DeliverPriority("m2", []string{"alice"}, "mention", "urgent"); err != nil {
+				t.Fatal(err)
+			}
+			if got := atomic.LoadUint64(&hub.counters.dropped); got != dropped {
+				t.Fatalf("优先事件不应被丢弃，丢弃计数从 %d 变为 %d", dropped, got)
+			}
+			alice.mu.Lock()
+			spilled := alice.spilled
+			alice.mu.Unlock()
+			if !spilled {
+				t.Fatal("优先事件应标记为等待重放")
+			}
+			expectPending(t, store, "alice", 2)
+		})
+	}
+}
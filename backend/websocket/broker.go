@@ -0,0 +1,132 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// 跨实例消息类型
+const (
+	brokerKindUser      = "user"      // 发送给指定用户
+	brokerKindUsers     = "users"     // 发送给一组用户
+	brokerKindBroadcast = "broadcast" // 广播给所有用户
+	brokerKindRoom      = "room"      // 发送给房间内的连接
+	brokerKindJoin      = "join"      // 用户加入房间
+	brokerKindLeave     = "leave"     // 用户离开房间
+	brokerKindKick      = "kick"      // 强制断开连接
+)
+
+// BrokerMessage 在实例之间传递的消息
+type BrokerMessage struct {
+	// 发布消息的实例ID，实例会忽略自己发布的消息
+	Origin string   `json:"origin"`
+	Kind   string   `json:"kind"`
+	UserID string   `json:"userId,omitempty"`
+	Users  []string `json:"users,omitempty"` // 一组用户ID
+	Room   string   `json:"room,omitempty"`
+	Except string   `json:"except,omitempty"` // 房间消息跳过的用户ID
+	Client string   `json:"client,omitempty"` // 强制断开的连接ID
+	Data   []byte   `json:"data,omitempty"`
+	// 不能被丢帧策略丢弃的事件
+	Priority bool `json:"priority,omitempty"`
+}
+
+// Broker 在多个后端实例之间转发Hub消息，使连接在任意实例上的用户都能收到
+type Broker interface {
+	// Publish 发布消息给所有实例
+	Publish(msg *BrokerMessage) error
+	// Subscribe 注册接收消息的回调，每个Hub调用一次
+	Subscribe(handler func(msg *BrokerMessage)) error
+	// Close 关闭连接
+	Close() error
+}
+
+// MemoryBroker 进程内的Broker，用于单实例部署和测试
+type MemoryBroker struct {
+	mu       sync.RWMutex
+	handlers []func(msg *BrokerMessage)
+}
+
+// NewMemoryBroker 创建进程内Broker
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{}
+}
+
+// Publish 同步调用所有订阅者
+func (b *MemoryBroker) Publish(msg *BrokerMessage) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for _, handler := range b.handlers {
+		handler(msg)
+	}
+	return nil
+}
+
+// Subscribe 注册接收消息的回调
+func (b *MemoryBroker) Subscribe(handler func(msg *BrokerMessage)) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.handlers = append(b.handlers, handler)
+	return nil
+}
+
+// Close 关闭Broker
+func (b *MemoryBroker) Close() error {
+	return nil
+}
+
+// RedisBroker 基于Redis发布订阅的Broker，用于多实例部署
+type RedisBroker struct {
+	client  *redis.Client
+	channel string
+}
+
+// NewRedisBroker 创建Redis Broker
+func NewRedisBroker(opts *redis.Options, channel string) *RedisBroker {
+	return &RedisBroker{client: redis.NewClient(opts), channel: channel}
+}
+
+// Publish 发布消息到Redis频道
+func (b *RedisBroker) Publish(msg *BrokerMessage) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	return b.client.Publish(context.Background(), b.channel, data).Err()
+}
+
+// Subscribe 订阅Redis频道，断线后由客户端自动重连
+func (b *RedisBroker) Subscribe(handler func(msg *BrokerMessage)) error {
+	pubsub := b.client.Subscribe(context.Background(), b.channel)
+
+	// 等待订阅确认，确保返回后发布的消息都能收到
+	if _, err := pubsub.Receive(context.Background()); err != nil {
+		pubsub.Close()
+		return err
+	}
+
+	go func() {
+		for m := range pubsub.Channel() {
+			var msg BrokerMessage
+			if err := json.Unmarshal([]byte(m.Payload), &msg); err != nil {
+				log.Printf("解析跨实例消息失败: %v", err)
+				continue
+			}
+			handler(&msg)
+		}
+	}()
+
+	return nil
+}
+
+// Close 关闭Redis连接
+func (b *RedisBroker) Close() error {
+	return b.client.Close()
+}
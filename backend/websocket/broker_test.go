@@ -0,0 +1,116 @@
+package websocket
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// newTestClient 注册一个没有网络连接的客户端，等待待确认事件重放完成
+func newTestClient(t *testing.T, hub *Hub, userID string) *Client {
+	t.Helper()
+
+	client := &Client{Hub: hub, UserID: userID, Send: make(chan *Frame, 16)}
+	hub.register <- client
+
+	// 注册和重放在Run循环中异步完成
+	deadline := time.Now().Add(time.Second)
+	for {
+		hub.mu.RLock()
+		registered := hub.clients[client]
+		hub.mu.RUnlock()
+		client.mu.Lock()
+		replaying := client.replaying
+		client.mu.Unlock()
+		if registered && !replaying {
+			return client
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("客户端 %s 注册超时", userID)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// expectMessage 断言客户端收到指定消息
+func expectMessage(t *testing.T, client *Client, want string) {
+	t.Helper()
+
+	select {
+	case got := <-client.Send:
+		if string(got.JSON()) != want {
+			t.Fatalf("%s 收到 %q，期望 %q", client.UserID, got.JSON(), want)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("%s 没有收到 %q", client.UserID, want)
+	}
+}
+
+// expectNoMessage 断言客户端没有收到消息
+func expectNoMessage(t *testing.T, client *Client) {
+	t.Helper()
+
+	select {
+	case got := <-client.Send:
+		t.Fatalf("%s 收到了不应收到的消息 %q", client.UserID, got.JSON())
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+// testCrossInstance 在同一进程中运行两个Hub，验证消息可以投递到另一个实例上的用户
+func testCrossInstance(t *testing.T, brokerA, brokerB Broker) {
+	hubA := NewHub()
+	hubA.SetBroker(brokerA)
+	go hubA.Run()
+
+	hubB := NewHub()
+	hubB.SetBroker(brokerB)
+	go hubB.Run()
+
+	alice := newTestClient(t, hubA, "alice")
+	bob := newTestClient(t, hubB, "bob")
+
+	// 发送给另一个实例上的用户
+	if hubA.SendToUser("bob", []byte("hello bob")) {
+		t.Fatal("bob不在实例A上，SendToUser应返回false")
+	}
+	expectMessage(t, bob, "hello bob")
+	expectNoMessage(t, alice)
+
+	// 发送给本实例上的用户不会重复投递
+	if !hubA.SendToUser("alice", []byte("hello alice")) {
+		t.Fatal("alice在实例A上，SendToUser应返回true")
+	}
+	expectMessage(t, alice, "hello alice")
+	expectNoMessage(t, alice)
+	expectNoMessage(t, bob)
+
+	// 广播到所有实例
+	hubB.Broadcast([]byte("hello all"))
+	expectMessage(t, alice, "hello all")
+	expectMessage(t, bob, "hello all")
+
+}
+
+func TestMemoryBrokerCrossInstance(t *testing.T) {
+	broker := NewMemoryBroker()
+	testCrossInstance(t, broker, broker)
+}
+
+func TestRedisBrokerCrossInstance(t *testing.T) {
+	addr := os.Getenv("REDIS_ADDR")
+	if addr == "" {
+		t.Skip("未设置REDIS_ADDR，跳过Redis集成测试")
+	}
+
+	channel := "gin-vue-chat:test:" + uuid.NewString()
+	brokerA := NewRedisBroker(&redis.Options{Addr: addr}, channel)
+	brokerB := NewRedisBroker(&redis.Options{Addr: addr}, channel)
+	defer brokerA.Close()
+	defer brokerB.Close()
+
+	testCrossInstance(t, brokerA, brokerB)
+}
@@ -0,0 +1,140 @@
+package websocket
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"sync"
+
+	"github.com/gorilla/websocket"
+	"github.com/ugorji/go/codec"
+)
+
+// 协商的WebSocket子协议，未指定子协议的连接使用JSON
+const (
+	SubprotocolJSON    = "chat.v1.json"
+	SubprotocolMsgpack = "chat.v1.msgpack"
+)
+
+// 帧编码格式
+const (
+	FormatJSON    = "json"    // JSON文本帧
+	FormatMsgpack = "msgpack" // MessagePack二进制帧，信封结构与JSON相同
+)
+
+// subprotocols 升级器支持的子协议，客户端同时提供多个时优先使用二进制编码
+var subprotocols = []string{SubprotocolMsgpack, SubprotocolJSON}
+
+// msgpackHandle MessagePack编解码配置，解码结果与encoding/json的类型一致
+var msgpackHandle = func() *codec.MsgpackHandle {
+	h := &codec.MsgpackHandle{}
+	h.MapType = reflect.TypeOf(map[string]interface{}(nil))
+	h.RawToString = true
+	h.WriteExt = true
+	return h
+}()
+
+// formatForSubprotocol 根据协商的子协议确定帧编码格式
+func formatForSubprotocol(subprotocol string) string {
+	if subprotocol == SubprotocolMsgpack {
+		return FormatMsgpack
+	}
+	return FormatJSON
+}
+
+// Frame 一个待发送的消息，JSON是规范格式，其他格式在第一次需要时转换并缓存，
+// 同一事件推送给多个连接时每种格式只编码一次
+type Frame struct {
+	data []byte
+	// 优先事件不会被丢帧策略丢弃
+	priority bool
+
+	once   sync.Once
+	packed []byte
+	err    error
+}
+
+// newFrame 用JSON编码的消息创建帧
+func newFrame(data []byte) *Frame {
+	return &Frame{data: data}
+}
+
+// JSON 返回JSON编码的消息
+func (f *Frame) JSON() []byte {
+	return f.data
+}
+
+// Encode 返回指定格式的消息
+func (f *Frame) Encode(format string) ([]byte, error) {
+	if format != FormatMsgpack {
+		return f.data, nil
+	}
+
+	f.once.Do(func() {
+		f.packed, f.err = jsonToMsgpack(f.data)
+	})
+	return f.packed, f.err
+}
+
+// jsonToMsgpack 将JSON消息转换为MessagePack，整数保持为整数
+func jsonToMsgpack(data []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+
+	var out []byte
+	if err := codec.NewEncoderBytes(&out, msgpackHandle).Encode(normalizeNumbers(value)); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// msgpackToJSON 将客户端发送的MessagePack消息转换为JSON，交给与JSON相同的处理器
+func msgpackToJSON(data []byte) ([]byte, error) {
+	var value interface{}
+	if err := codec.NewDecoderBytes(data, msgpackHandle).Decode(&value); err != nil {
+		return nil, err
+	}
+	return json.Marshal(value)
+}
+
+// normalizeNumbers 将json.Number转换为int64或float64
+func normalizeNumbers(value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = normalizeNumbers(item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = normalizeNumbers(item)
+		}
+	}
+	return value
+}
+
+// messageType 帧编码格式对应的WebSocket消息类型
+func messageType(format string) int {
+	if format == FormatMsgpack {
+		return websocket.BinaryMessage
+	}
+	return websocket.TextMessage
+}
+
+// decodeInbound 将客户端发送的帧转换为JSON，二进制帧按MessagePack解析
+func decodeInbound(msgType int, data []byte) ([]byte, error) {
+	if msgType == websocket.BinaryMessage {
+		return msgpackToJSON(data)
+	}
+	return data, nil
+}
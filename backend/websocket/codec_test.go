@@ -0,0 +1,179 @@
+package websocket
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/ugorji/go/codec"
+)
+
+func TestSubprotocolNegotiation(t *testing.T) {
+	upgrader := newUpgrader()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer ws.Close()
+		ws.WriteMessage(websocket.TextMessage, []byte(formatForSubprotocol(ws.Subprotocol())))
+	}))
+	defer server.Close()
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	tests := []struct {
+		name    string
+		offered []string
+		want    string
+	}{
+		{"未指定子协议使用JSON", nil, FormatJSON},
+		{"只支持JSON", []string{SubprotocolJSON}, FormatJSON},
+		{"只支持MessagePack", []string{SubprotocolMsgpack}, FormatMsgpack},
+		{"同时支持时优先二进制编码", []string{SubprotocolJSON, SubprotocolMsgpack}, FormatMsgpack},
+		{"不认识的子协议使用JSON", []string{"chat.v2.cbor"}, FormatJSON},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dialer := websocket.Dialer{Subprotocols: tt.offered}
+			ws, _, err := dialer.Dial(url, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer ws.Close()
+
+			_, data, err := ws.ReadMessage()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != tt.want {
+				t.Fatalf("协商的格式为 %s，期望 %s", data, tt.want)
+			}
+		})
+	}
+}
+
+// decodeMsgpack 解码MessagePack数据，便于比较转换结果
+func decodeMsgpack(t *testing.T, data []byte) interface{} {
+	t.Helper()
+
+	var value interface{}
+	if err := codec.NewDecoderBytes(data, msgpackHandle).Decode(&value); err != nil {
+		t.Fatal(err)
+	}
+	return value
+}
+
+func TestJSONToMsgpack(t *testing.T) {
+	data := []byte(`{"v":1,"type":"message","payload":{"count":42,"negative":-7,"ratio":0.5,"big":9007199254740993,"text":"你好","ok":true,"none":null,"list":[1,"a",2.5]}}`)
+
+	packed, err := jsonToMsgpack(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	envelope, ok := decodeMsgpack(t, packed).(map[string]interface{})
+	if !ok {
+		t.Fatalf("解码结果不是对象: %#v", envelope)
+	}
+	if envelope["type"] != "message" {
+		t.Fatalf("type为 %#v，期望 message", envelope["type"])
+	}
+
+	payload := envelope["payload"].(map[string]interface{})
+	// 整数保持为整数，不会变成浮点数丢失精度
+	for key, want := range map[string]int64{"count": 42, "negative": -7, "big": 9007199254740993} {
+		if payload[key] != want {
+			t.Fatalf("%s 为 %#v，期望整数 %d", key, payload[key], want)
+		}
+	}
+	if payload["ratio"] != 0.5 {
+		t.Fatalf("ratio为 %#v，期望 0.5", payload["ratio"])
+	}
+	if payload["text"] != "你好" || payload["ok"] != true || payload["none"] != nil {
+		t.Fatalf("转换结果不一致: %#v", payload)
+	}
+
+	if _, err := jsonToMsgpack([]byte(`{"v":`)); err == nil {
+		t.Fatal("无效的JSON没有返回错误")
+	}
+}
+
+func TestMsgpackRoundTrip(t *testing.T) {
+	data := []byte(`{"id":"abc","type":"send_message","payload":{"content":"周五上线","count":3,"ratio":1.25,"tags":["a","b"],"reply":null}}`)
+
+	packed, err := jsonToMsgpack(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	back, err := msgpackToJSON(packed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var want, got interface{}
+	if err := json.Unmarshal(data, &want); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(back, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("往返转换结果为 %s，期望 %s", back, data)
+	}
+}
+
+func TestFrameEncode(t *testing.T) {
+	data := []byte(`{"v":1,"type":"read","payload":"hi"}`)
+	frame := newFrame(data)
+
+	if got, err := frame.Encode(FormatJSON); err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("JSON格式返回 %q, %v，期望原始数据", got, err)
+	}
+
+	packed, err := frame.Encode(FormatMsgpack)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 同一帧推送给多个连接时只转换一次
+	again, _ := frame.Encode(FormatMsgpack)
+	if &packed[0] != &again[0] {
+		t.Fatal("MessagePack编码没有缓存")
+	}
+
+	if _, err := newFrame([]byte("not json")).Encode(FormatMsgpack); err == nil {
+		t.Fatal("无效的JSON没有返回错误")
+	}
+}
+
+func TestDecodeInbound(t *testing.T) {
+	text := []byte(`{"type":"ping"}`)
+	if got, err := decodeInbound(websocket.TextMessage, text); err != nil || !bytes.Equal(got, text) {
+		t.Fatalf("文本帧返回 %q, %v，期望原样返回", got, err)
+	}
+
+	packed, err := jsonToMsgpack(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := decodeInbound(websocket.BinaryMessage, packed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(text) {
+		t.Fatalf("二进制帧转换为 %s，期望 %s", got, text)
+	}
+
+	if _, err := decodeInbound(websocket.BinaryMessage, []byte{0xc1}); err == nil {
+		t.Fatal("无效的MessagePack没有返回错误")
+	}
+
+	if messageType(FormatMsgpack) != websocket.BinaryMessage || messageType(FormatJSON) != websocket.TextMessage {
+		t.Fatal("帧编码格式对应的消息类型错误")
+	}
+}
@@ -7,29 +7,102 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
+	"github.com/yourusername/gin-vue-chat/config"
 )
 
+// 连接参数的默认值，可以通过配置覆盖
 const (
 	// 允许的写入WebSocket连接的最大时间
-	writeWait = 10 * time.Second
+	defaultWriteWait = 10 * time.Second
 
 	// 允许的读取下一个pong消息的最大时间
-	pongWait = 60 * time.Second
+	defaultPongWait = 60 * time.Second
+
+	// 允许的最大消息大小
+	defaultMaxMessageSize = 4096
+
+	// 读写缓冲区大小
+	defaultReadBufferSize  = 1024
+	defaultWriteBufferSize = 1024
+)
+
+// connOptions WebSocket连接参数
+type connOptions struct {
+	// 允许的写入WebSocket连接的最大时间
+	writeWait time.Duration
+
+	// 允许的读取下一个pong消息的最大时间
+	pongWait time.Duration
 
 	// 发送ping到peer的频率，必须小于pongWait
-	pingPeriod = (pongWait * 9) / 10
+	pingPeriod time.Duration
 
 	// 允许的最大消息大小
-	maxMessageSize = 512
-)
+	maxMessageSize int64
+
+	// 启用压缩时的压缩级别
+	compressionLevel int
+}
+
+// newConnOptions 读取配置的连接参数
+func newConnOptions() connOptions {
+	cfg := config.AppConfig.WebSocket
+	opts := connOptions{
+		writeWait:      cfg.WriteWait,
+		pongWait:       cfg.PongWait,
+		pingPeriod:     cfg.PingPeriod,
+		maxMessageSize: cfg.MaxMessageSize,
+
+		compressionLevel: cfg.CompressionLevel,
+	}
+
+	if opts.writeWait <= 0 {
+		opts.writeWait = defaultWriteWait
+	}
+	if opts.pongWait <= 0 {
+		opts.pongWait = defaultPongWait
+	}
+	if opts.pingPeriod <= 0 || opts.pingPeriod >= opts.pongWait {
+		opts.pingPeriod = (opts.pongWait * 9) / 10
+	}
+	if opts.maxMessageSize <= 0 {
+		opts.maxMessageSize = defaultMaxMessageSize
+	}
+	return opts
+}
+
+// newUpgrader 根据配置创建升级器
+func newUpgrader() websocket.Upgrader {
+	cfg := config.AppConfig.WebSocket
+	upgrader := websocket.Upgrader{
+		ReadBufferSize:  cfg.ReadBufferSize,
+		WriteBufferSize: cfg.WriteBufferSize,
+		Subprotocols:    subprotocols,
+		// 与客户端协商permessage-deflate压缩
+		EnableCompression: cfg.EnableCompression,
+	}
+
+	if upgrader.ReadBufferSize <= 0 {
+		upgrader.ReadBufferSize = defaultReadBufferSize
+	}
+	if upgrader.WriteBufferSize <= 0 {
+		upgrader.WriteBufferSize = defaultWriteBufferSize
+	}
+	return upgrader
+}
+
+// SetOriginChecker 设置允许升级的来源，应与REST接口的跨域策略一致，必须在Run之前调用。
+// 没有Origin头的请求来自非浏览器客户端，不受跨域限制
+func (h *Hub) SetOriginChecker(allow func(origin string) bool) {
+	h.upgrader.CheckOrigin = func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if origin == "" || allow(origin) {
+			return true
+		}
 
-var upgrader = websocket.Upgrader{
-	ReadBufferSize:  1024,
-	WriteBufferSize: 1024,
-	// 允许所有CORS请求
-	CheckOrigin: func(r *http.Request) bool {
-		return true
-	},
+		log.Printf("拒绝WebSocket升级: 来源 %s 不在允许列表中 (remote=%s)", origin, r.RemoteAddr)
+		return false
+	}
 }
 
 // Connection 封装了websocket连接
@@ -43,31 +116,67 @@ type Connection struct {
 
 // ServeWs 处理WebSocket请求
 func ServeWs(hub *Hub, c *gin.Context) {
-	// 从上下文中获取用户ID
-	userID, exists := c.Get("userId")
-	if !exists {
+	// 通过票据认证的请求在上下文中带有用户ID，否则需要在连接建立后发送认证消息
+	userID := c.GetString("userId")
+	if hub.Closed() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "服务器正在关闭"})
+		return
+	}
+	if userID == "" && hub.authenticator == nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
 		return
 	}
 
 	// 升级HTTP连接为WebSocket连接
-	ws, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	ws, err := hub.upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
 		log.Println("升级连接失败:", err)
 		return
 	}
 
+	// 根据协商的子协议确定帧编码格式
+	format := formatForSubprotocol(ws.Subprotocol())
+	if hub.upgrader.EnableCompression && hub.connOptions.compressionLevel != 0 {
+		if err := ws.SetCompressionLevel(hub.connOptions.compressionLevel); err != nil {
+			log.Printf("设置压缩级别失败: %v", err)
+		}
+	}
+
+	if userID == "" {
+		var ok bool
+		if userID, ok = hub.authenticate(ws, format); !ok {
+			return
+		}
+	}
+
 	// 创建连接和客户端
-	conn := &Connection{ws: ws, userID: userID.(string)}
-	client := &Client{Hub: hub, Conn: conn, UserID: userID.(string), Send: make(chan []byte, 256)}
+	conn := &Connection{ws: ws, userID: userID}
+	client := hub.newClient(c, userID, TransportWebSocket)
+	client.Conn = conn
+	client.format = format
 
 	// 注册客户端
-	client.Hub.register <- client
+	if !hub.addWriter() {
+		ws.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down"))
+		ws.Close()
+		return
+	}
+	if !hub.registerClient(client) {
+		hub.writers.Done()
+		ws.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down"))
+		ws.Close()
+		return
+	}
 
 	// 允许收集未使用的内存
-	ws.SetReadLimit(maxMessageSize)
-	ws.SetReadDeadline(time.Now().Add(pongWait))
-	ws.SetPongHandler(func(string) error { ws.SetReadDeadline(time.Now().Add(pongWait)); return nil })
+	opts := hub.connOptions
+	ws.SetReadLimit(opts.maxMessageSize)
+	ws.SetReadDeadline(time.Now().Add(opts.pongWait))
+	ws.SetPongHandler(func(string) error {
+		client.touch()
+		ws.SetReadDeadline(time.Now().Add(opts.pongWait))
+		return nil
+	})
 
 	// 启动goroutines处理读写
 	go client.writePump()
@@ -77,12 +186,12 @@ func ServeWs(hub *Hub, c *gin.Context) {
 // readPump 从WebSocket连接泵取消息
 func (c *Client) readPump() {
 	defer func() {
-		c.Hub.unregister <- c
+		c.Hub.unregisterClient(c)
 		c.Conn.ws.Close()
 	}()
 
 	for {
-		_, message, err := c.Conn.ws.ReadMessage()
+		msgType, data, err := c.Conn.ws.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				log.Printf("错误: %v", err)
@@ -90,47 +199,60 @@ func (c *Client) readPump() {
 			break
 		}
 
-		// 处理接收到的消息
-		log.Printf("收到消息: %s", message)
-		c.Hub.broadcast <- message
+		// 二进制帧转换为JSON后与文本帧使用相同的处理器
+		message, err := decodeInbound(msgType, data)
+		if err != nil {
+			c.reply("", FrameError, NewError(http.StatusBadRequest, "消息格式无效"))
+			continue
+		}
+
+		// 按消息类型分发处理
+		c.handleMessage(message)
 	}
 }
 
 // writePump 将消息泵送到WebSocket连接
 func (c *Client) writePump() {
-	ticker := time.NewTicker(pingPeriod)
+	opts := c.Hub.connOptions
+	ticker := time.NewTicker(opts.pingPeriod)
 	defer func() {
 		ticker.Stop()
 		c.Conn.ws.Close()
+		c.Hub.writers.Done()
 	}()
 
 	for {
 		select {
 		case message, ok := <-c.Send:
-			c.Conn.ws.SetWriteDeadline(time.Now().Add(writeWait))
+			c.Conn.ws.SetWriteDeadline(time.Now().Add(opts.writeWait))
 			if !ok {
-				// Hub关闭了通道
-				c.Conn.ws.WriteMessage(websocket.CloseMessage, []byte{})
+				// Hub关闭了通道，服务器关闭时告知客户端稍后重连
+				closeMessage := []byte{}
+				if c.Hub.Closed() {
+					closeMessage = websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+				} else if c.isKicked() {
+					closeMessage = websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "session revoked")
+				}
+				c.Conn.ws.WriteMessage(websocket.CloseMessage, closeMessage)
 				return
 			}
 
-			w, err := c.Conn.ws.NextWriter(websocket.TextMessage)
+			// 每条消息单独作为一帧发送，客户端按帧解析信封
+			data, err := message.Encode(c.format)
 			if err != nil {
-				return
+				log.Printf("消息编码失败 (%s): %v", c.format, err)
+				continue
 			}
-			w.Write(message)
-
-			// 添加队列中的所有消息到当前的writer
-			n := len(c.Send)
-			for i := 0; i < n; i++ {
-				w.Write(<-c.Send)
+			if err := c.Conn.ws.WriteMessage(messageType(c.format), data); err != nil {
+				return
 			}
 
-			if err := w.Close(); err != nil {
-				return
+			// 缓冲区清空后重放溢出的事件
+			if len(c.Send) == 0 {
+				c.drained()
 			}
 		case <-ticker.C:
-			c.Conn.ws.SetWriteDeadline(time.Now().Add(writeWait))
+			c.Conn.ws.SetWriteDeadline(time.Now().Add(opts.writeWait))
 			if err := c.Conn.ws.WriteMessage(websocket.PingMessage, nil); err != nil {
 				return
 			}
@@ -0,0 +1,297 @@
+package websocket
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// FrameEventAck 客户端确认已收到事件的消息类型
+const FrameEventAck = "event_ack"
+
+const (
+	// 重放时发送缓冲区已满的最大重试次数
+	replayRetries = 20
+
+	// 重放重试间隔
+	replayRetryDelay = 50 * time.Millisecond
+)
+
+// eventAckRequest 事件确认请求
+type eventAckRequest struct {
+	IDs []string `json:"ids"`
+}
+
+// encodeEvent 将事件编码为消息信封
+func encodeEvent(id, eventType string, payload interface{}) ([]byte, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(Envelope{V: ProtocolVersion, Type: eventType, ID: id, Payload: data})
+}
+
+// SetPendingStore 设置待确认事件存储，必须在Run之前调用
+func (h *Hub) SetPendingStore(store PendingStore) {
+	h.pending = store
+}
+
+// Notify 推送不需要确认的事件，用户不在线时直接丢弃
+func (h *Hub) Notify(userID, eventType string, payload interface{}) bool {
+	data, err := encodeEvent("", eventType, payload)
+	if err != nil {
+		log.Printf("事件序列化失败: %v", err)
+		return false
+	}
+
+	return h.SendToUser(userID, data)
+}
+
+// NotifyUsers 推送不需要确认的事件给一组用户，事件只编码一次，
+// 用户不在线时直接丢弃
+func (h *Hub) NotifyUsers(userIDs []string, eventType string, payload interface{}) error {
+	if len(userIDs) == 0 {
+		return nil
+	}
+
+	data, err := encodeEvent("", eventType, payload)
+	if err != nil {
+		return err
+	}
+
+	h.sendToLocalUsers(userIDs, newFrame(data))
+	h.publish(&BrokerMessage{Kind: brokerKindUsers, Users: userIDs, Data: data})
+	return nil
+}
+
+// Deliver 推送需要确认的事件。事件先写入待确认存储再尝试实时推送，
+// 客户端确认前会在每次重连时重放，保证至少送达一次
+func (h *Hub) Deliver(userID, eventType string, payload interface{}) error {
+	id := primitive.NewObjectID().Hex()
+	data, err := encodeEvent(id, eventType, payload)
+	if err != nil {
+		return err
+	}
+
+	event := &PendingEvent{ID: id, UserID: userID, Data: data, CreatedAt: time.Now()}
+	if err := h.pending.Push(event); err != nil {
+		// 存储失败时仍尝试实时推送
+		log.Printf("保存待确认事件失败 (%s): %v", userID, err)
+	}
+
+	h.SendToUser(userID, data)
+	return nil
+}
+
+// DeliverToUsers 推送需要确认的事件给一组用户，例如话题的参与者。
+// 事件只编码一次，每个接收者各写一条待确认记录，各自确认互不影响
+func (h *Hub) DeliverToUsers(userIDs []string, eventType string, payload interface{}) error {
+	return h.DeliverRef("", userIDs, eventType, payload)
+}
+
+// DeliverRef 与DeliverToUsers相同，ref为事件关联的对象ID，例如消息ID，
+// 对象被撤回后通过DropRef删除尚未确认的事件
+func (h *Hub) DeliverRef(ref string, userIDs []string, eventType string, payload interface{}) error {
+	return h.deliver(ref, userIDs, eventType, payload, false)
+}
+
+// DeliverPriority 与DeliverRef相同，但事件不会被丢帧策略丢弃，例如@提醒。
+// 发送缓冲区已满时事件留在待确认存储中，缓冲区清空后重放
+func (h *Hub) DeliverPriority(ref string, userIDs []string, eventType string, payload interface{}) error {
+	return h.deliver(ref, userIDs, eventType, payload, true)
+}
+
+// deliver 保存每个接收者的待确认记录，然后推送给所有实例上的连接
+func (h *Hub) deliver(ref string, userIDs []string, eventType string, payload interface{}, priority bool) error {
+	if len(userIDs) == 0 {
+		return nil
+	}
+
+	id := primitive.NewObjectID().Hex()
+	data, err := encodeEvent(id, eventType, payload)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	events := make([]*PendingEvent, 0, len(userIDs))
+	for _, userID := range userIDs {
+		events = append(events, &PendingEvent{ID: id, UserID: userID, Ref: ref, Data: data, CreatedAt: now})
+	}
+	if err := h.pending.PushMany(events); err != nil {
+		log.Printf("保存待确认事件失败 (%d个用户): %v", len(userIDs), err)
+	}
+
+	h.sendToLocalUsers(userIDs, &Frame{data: data, priority: priority})
+	h.publish(&BrokerMessage{Kind: brokerKindUsers, Users: userIDs, Data: data, Priority: priority})
+	return nil
+}
+
+// roomEventSeparator 房间事件ID中事件ID和房间的分隔符，客户端把事件ID当作不透明的字符串，
+// 确认时原样返回，据此找到事件所在的房间
+const roomEventSeparator = "@"
+
+// roomEventID 返回房间事件在消息信封中的ID
+func roomEventID(id, room string) string {
+	return id + roomEventSeparator + room
+}
+
+// DeliverToRoom 推送需要确认的事件给房间内所有实例上的连接，例如群组消息。
+// 事件只编码、保存和转发一次，成员重连时按各自在房间中的确认位置重放，
+// 确认一个房间事件同时确认了该房间中更早的事件。exceptUserID不为空时跳过该用户，
+// ref为事件关联的对象ID
+func (h *Hub) DeliverToRoom(ref, room, eventType string, payload interface{}, exceptUserID string) error {
+	id := primitive.NewObjectID().Hex()
+	data, err := encodeEvent(roomEventID(id, room), eventType, payload)
+	if err != nil {
+		return err
+	}
+
+	event := &PendingEvent{ID: id, Room: room, Except: exceptUserID, Ref: ref, Data: data, CreatedAt: time.Now()}
+	if err := h.pending.PushRoom(event); err != nil {
+		log.Printf("保存房间事件失败 (%s): %v", room, err)
+	}
+
+	h.sendToLocalRoom(room, newFrame(data), exceptUserID)
+	h.publish(&BrokerMessage{Kind: brokerKindRoom, Room: room, Except: exceptUserID, Data: data})
+	return nil
+}
+
+// DropRef 删除关联某个对象的所有待确认事件，重连时不再重放
+func (h *Hub) DropRef(ref string) error {
+	return h.pending.DropRef(ref)
+}
+
+// replayOnConnect 新连接建立后先重放待确认事件，再发送重放期间暂存的实时消息。
+// 暂存的消息中已经重放过的事件不再重复发送
+func (h *Hub) replayOnConnect(client *Client) {
+	// 先订阅房间，之后到达的房间事件暂存在held中，之前的从存储中重放
+	h.loadRooms(client)
+	replayed := h.replayPending(client)
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	held := client.held
+	client.held = nil
+	client.replaying = false
+
+	// 客户端已注销时通道已关闭
+	if _, ok := h.clients[client]; !ok {
+		return
+	}
+	for _, frame := range held {
+		if id := frameID(frame); id != "" && replayed[id] {
+			continue
+		}
+		h.enqueueLocked(client, frame)
+	}
+}
+
+// frameID 返回帧的事件ID，没有ID时返回空
+func frameID(frame *Frame) string {
+	var env struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(frame.JSON(), &env); err != nil {
+		return ""
+	}
+	return env.ID
+}
+
+// pendingEvents 按发送顺序返回连接需要重放的事件：用户尚未确认的事件，
+// 以及订阅的房间中确认位置之后的事件。没有确认位置的房间从现在开始记录，不重放
+func (h *Hub) pendingEvents(client *Client) ([]*PendingEvent, error) {
+	events, err := h.pending.List(client.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	h.mu.RLock()
+	rooms := make([]string, 0, len(client.rooms))
+	for room := range client.rooms {
+		rooms = append(rooms, room)
+	}
+	h.mu.RUnlock()
+	if len(rooms) == 0 {
+		return events, nil
+	}
+
+	cursors, err := h.pending.RoomCursors(client.UserID, rooms)
+	if err != nil {
+		return nil, err
+	}
+	missing := make(map[string]string)
+	now := primitive.NewObjectID().Hex()
+	for _, room := range rooms {
+		if _, ok := cursors[room]; !ok {
+			missing[room] = now
+		}
+	}
+	if err := h.pending.AckRoom(client.UserID, missing); err != nil {
+		log.Printf("初始化房间确认位置失败 (%s): %v", client.UserID, err)
+	}
+
+	roomEvents, err := h.pending.ListRooms(cursors)
+	if err != nil {
+		return nil, err
+	}
+	for _, event := range roomEvents {
+		if event.Except != client.UserID {
+			events = append(events, event)
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].ID < events[j].ID })
+	return events, nil
+}
+
+// replayPending 按顺序重放连接尚未确认的事件，返回已重放的事件ID
+func (h *Hub) replayPending(client *Client) map[string]bool {
+	replayed := make(map[string]bool)
+	events, err := h.pendingEvents(client)
+	if err != nil {
+		log.Printf("获取待确认事件失败 (%s): %v", client.UserID, err)
+		return replayed
+	}
+
+	for _, event := range events {
+		// 待确认事件可能多于发送缓冲区，等待writePump消费后重试
+		frame := newFrame(event.Data)
+		for attempt := 0; !h.trySendToClient(client, frame); attempt++ {
+			if attempt >= replayRetries {
+				// 剩余事件保留在存储中，下次连接时再重放
+				log.Printf("重放待确认事件中断 (%s): 停在 %s", client.UserID, event.ID)
+				return replayed
+			}
+			time.Sleep(replayRetryDelay)
+		}
+		if event.Room != "" {
+			replayed[roomEventID(event.ID, event.Room)] = true
+		} else {
+			replayed[event.ID] = true
+		}
+	}
+	return replayed
+}
+
+// handleEventAck 处理客户端的事件确认
+func (h *Hub) handleEventAck(c *Client, payload json.RawMessage) (interface{}, error) {
+	var req eventAckRequest
+	if err := json.Unmarshal(payload, &req); err != nil || len(req.IDs) == 0 {
+		return nil, NewError(http.StatusBadRequest, "请求参数无效")
+	}
+
+	if err := h.AckEvents(c.UserID, req.IDs); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,183 @@
+package websocket
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// expectEvent 断言客户端收到指定类型的事件，返回事件ID
+func expectEvent(t *testing.T, client *Client, eventType string) string {
+	t.Helper()
+
+	select {
+	case frame := <-client.Send:
+		var env Envelope
+		if err := json.Unmarshal(frame.JSON(), &env); err != nil {
+			t.Fatalf("%s 收到无效的帧 %q: %v", client.UserID, frame.JSON(), err)
+		}
+		if env.Type != eventType || env.ID == "" {
+			t.Fatalf("%s 收到 %q，期望带ID的 %s 事件", client.UserID, frame.JSON(), eventType)
+		}
+		return env.ID
+	case <-time.After(2 * time.Second):
+		t.Fatalf("%s 没有收到 %s 事件", client.UserID, eventType)
+	}
+	return ""
+}
+
+// expectPending 断言用户待确认事件的数量
+func expectPending(t *testing.T, store PendingStore, userID string, want int) {
+	t.Helper()
+
+	events, err := store.List(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != want {
+		t.Fatalf("%s 有 %d 个待确认事件，期望 %d 个", userID, len(events), want)
+	}
+}
+
+func TestDeliverToUsers(t *testing.T) {
+	broker := NewMemoryBroker()
+	// 多个实例共享同一个待确认存储
+	store := NewMemoryPendingStore()
+
+	hubA := NewHub()
+	hubA.SetBroker(broker)
+	hubA.SetPendingStore(store)
+	go hubA.Run()
+
+	hubB := NewHub()
+	hubB.SetBroker(broker)
+	hubB.SetPendingStore(store)
+	go hubB.Run()
+
+	alice := newTestClient(t, hubA, "alice")
+	bob := newTestClient(t, hubB, "bob")
+
+	if err := hubA.DeliverToUsers([]string{"alice", "bob", "carol"}, "group", "hi"); err != nil {
+		t.Fatal(err)
+	}
+
+	// 所有接收者收到同一个事件ID
+	id := expectEvent(t, alice, "group")
+	if got := expectEvent(t, bob, "group"); got != id {
+		t.Fatalf("bob收到的事件ID %s 与alice的 %s 不同", got, id)
+	}
+	for _, userID := range []string{"alice", "bob", "carol"} {
+		expectPending(t, store, userID, 1)
+	}
+
+	// 确认只删除自己的记录
+	if err := hubA.AckEvents("alice", []string{id}); err != nil {
+		t.Fatal(err)
+	}
+	expectPending(t, store, "alice", 0)
+	expectPending(t, store, "bob", 1)
+
+	// 离线用户连接后重放
+	carol := newTestClient(t, hubB, "carol")
+	if got := expectEvent(t, carol, "group"); got != id {
+		t.Fatalf("carol重放的事件ID %s，期望 %s", got, id)
+	}
+	expectNoMessage(t, alice)
+}
+
+func TestNotifyUsers(t *testing.T) {
+	broker := NewMemoryBroker()
+	store := NewMemoryPendingStore()
+
+	hubA := NewHub()
+	hubA.SetBroker(broker)
+	hubA.SetPendingStore(store)
+	go hubA.Run()
+
+	hubB := NewHub()
+	hubB.SetBroker(broker)
+	hubB.SetPendingStore(store)
+	go hubB.Run()
+
+	alice := newTestClient(t, hubA, "alice")
+	bob := newTestClient(t, hubB, "bob")
+	carol := newTestClient(t, hubB, "carol")
+
+	if err := hubA.NotifyUsers([]string{"alice", "bob"}, "read", "hi"); err != nil {
+		t.Fatal(err)
+	}
+
+	// 只推送给指定用户，不写入待确认存储
+	want := `{"v":1,"type":"read","payload":"hi"}`
+	expectMessage(t, alice, want)
+	expectMessage(t, bob, want)
+	expectNoMessage(t, carol)
+	expectPending(t, store, "alice", 0)
+	expectPending(t, store, "bob", 0)
+}
+
+func TestDropRef(t *testing.T) {
+	store := NewMemoryPendingStore()
+	hub := NewHub()
+	hub.SetPendingStore(store)
+
+	// 没有运行Run循环，事件只写入待确认存储
+	if err := hub.DeliverRef("m1", []string{"alice", "bob"}, "private", "secret"); err != nil {
+		t.Fatal(err)
+	}
+	if err := hub.DeliverRef("m2", []string{"alice"}, "private", "kept"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := hub.DropRef("m1"); err != nil {
+		t.Fatal(err)
+	}
+	expectPending(t, store, "alice", 1)
+	expectPending(t, store, "bob", 0)
+
+	events, _ := store.List("alice")
+	if events[0].Ref != "m2" {
+		t.Fatalf("保留了错误的事件 %+v", events[0])
+	}
+}
+
+// blockingPendingStore 在List返回前等待放行，用于模拟慢速的存储
+type blockingPendingStore struct {
+	*MemoryPendingStore
+	listing chan struct{}
+	release chan struct{}
+}
+
+func (s *blockingPendingStore) List(userID string) ([]*PendingEvent, error) {
+	close(s.listing)
+	<-s.release
+	return s.MemoryPendingStore.List(userID)
+}
+
+func TestReplayBeforeLiveEvents(t *testing.T) {
+	store := &blockingPendingStore{
+		MemoryPendingStore: NewMemoryPendingStore(),
+		listing:            make(chan struct{}),
+		release:            make(chan struct{}),
+	}
+	hub := NewHub()
+	hub.SetPendingStore(store)
+	go hub.Run()
+
+	// 离线期间的事件
+	if err := hub.Deliver("alice", "private", "queued"); err != nil {
+		t.Fatal(err)
+	}
+
+	alice := &Client{Hub: hub, UserID: "alice", Send: make(chan *Frame, 16)}
+	hub.register <- alice
+	<-store.listing
+
+	// 重放期间到达的实时消息排在重放的事件之后
+	hub.SendToUser("alice", []byte("live"))
+	expectNoMessage(t, alice)
+	close(store.release)
+
+	expectEvent(t, alice, "private")
+	expectMessage(t, alice, "live")
+}
@@ -0,0 +1,310 @@
+package websocket
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// 客户端连接的传输方式
+const (
+	TransportWebSocket = "websocket" // WebSocket双向连接
+	TransportSSE       = "sse"       // Server-Sent Events单向推送
+	TransportLongPoll  = "longpoll"  // 长轮询
+)
+
+const (
+	// 长轮询默认和最长的等待时间
+	defaultPollTimeout = 25 * time.Second
+	maxPollTimeout     = 60 * time.Second
+
+	// 两次轮询之间允许的最长间隔，超过后会话被注销
+	pollSessionIdle = 60 * time.Second
+)
+
+// pollSession 长轮询会话，在多次请求之间保持客户端注册，期间的事件留在发送缓冲区中
+type pollSession struct {
+	id     string
+	client *Client
+	// 空闲超时计时器，轮询进行中时停止
+	idle *time.Timer
+	// 是否有进行中的轮询请求
+	polling bool
+}
+
+// pollSessions 长轮询会话集合
+type pollSessions struct {
+	mu       sync.Mutex
+	sessions map[string]*pollSession
+}
+
+// newClient 创建一个尚未注册的客户端，记录请求的来源信息
+func (h *Hub) newClient(c *gin.Context, userID, transport string) *Client {
+	client := &Client{
+		ID:          uuid.NewString(),
+		Hub:         h,
+		UserID:      userID,
+		Transport:   transport,
+		Send:        make(chan *Frame, h.sendBufferSize),
+		ConnectedAt: time.Now(),
+		RemoteAddr:  c.ClientIP(),
+		UserAgent:   c.Request.UserAgent(),
+	}
+	client.touch()
+	return client
+}
+
+// AckEvents 确认事件已被客户端处理，供不能发送WebSocket消息的传输方式使用。
+// 房间事件推进用户在房间中的确认位置
+func (h *Hub) AckEvents(userID string, ids []string) error {
+	var eventIDs []string
+	cursors := make(map[string]string)
+	for _, id := range ids {
+		eventID, room, ok := strings.Cut(id, roomEventSeparator)
+		if !ok {
+			eventIDs = append(eventIDs, id)
+			continue
+		}
+		if primitive.IsValidObjectID(eventID) && eventID > cursors[room] {
+			cursors[room] = eventID
+		}
+	}
+
+	if len(eventIDs) > 0 {
+		if err := h.pending.Ack(userID, eventIDs); err != nil {
+			return err
+		}
+	}
+	return h.pending.AckRoom(userID, cursors)
+}
+
+// ServeSSE 通过Server-Sent Events推送事件，事件内容与WebSocket帧相同。
+// 客户端通过REST接口发送消息和确认事件
+func ServeSSE(hub *Hub, c *gin.Context) {
+	userID := c.GetString("userId")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
+		return
+	}
+
+	flusher, ok := c.Writer.(http.Flusher)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "不支持流式响应"})
+		return
+	}
+
+	client := hub.newClient(c, userID, TransportSSE)
+	if !hub.addWriter() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "服务器正在关闭"})
+		return
+	}
+	defer hub.writers.Done()
+	if !hub.registerClient(client) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "服务器正在关闭"})
+		return
+	}
+	defer hub.unregisterClient(client)
+
+	header := c.Writer.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	// 禁止反向代理缓冲
+	header.Set("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	// 立即发送响应头，客户端据此确认连接建立
+	fmt.Fprint(c.Writer, ": connected\n\n")
+	flusher.Flush()
+
+	ticker := time.NewTicker(hub.connOptions.pingPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case message, ok := <-client.Send:
+			if !ok {
+				// Hub关闭了通道
+				return
+			}
+
+			// JSON编码的帧不含换行，可以直接作为一行data发送
+			if _, err := fmt.Fprintf(c.Writer, "data: %s\n\n", message.JSON()); err != nil {
+				return
+			}
+			flusher.Flush()
+
+			// 缓冲区清空后重放溢出的事件
+			if len(client.Send) == 0 {
+				client.drained()
+			}
+
+		case <-ticker.C:
+			// 注释行作为心跳，防止代理关闭空闲连接
+			if _, err := fmt.Fprint(c.Writer, ": ping\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+			client.touch()
+
+		case <-c.Request.Context().Done():
+			return
+		}
+	}
+}
+
+// ServeLongPoll 通过长轮询返回事件。第一次请求凭票据创建会话，之后的请求通过session参数继续接收；
+// 请求在有事件或超时后返回，事件内容与WebSocket帧相同
+func ServeLongPoll(hub *Hub, c *gin.Context) {
+	userID := c.GetString("userId")
+	if userID == "" {
+		// 未携带票据时会话ID即凭证，会话过期后需要新的票据
+		userID = hub.pollSessionOwner(c.Query("session"))
+	}
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "会话已过期，请使用新的连接票据"})
+		return
+	}
+
+	timeout := defaultPollTimeout
+	if seconds, err := strconv.Atoi(c.Query("timeout")); err == nil && seconds >= 0 {
+		timeout = time.Duration(seconds) * time.Second
+		if timeout > maxPollTimeout {
+			timeout = maxPollTimeout
+		}
+	}
+
+	if hub.Closed() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "服务器正在关闭"})
+		return
+	}
+
+	session, ok := hub.startPoll(c, c.Query("session"), userID)
+	if !ok {
+		c.JSON(http.StatusConflict, gin.H{"error": "该会话已有进行中的轮询请求"})
+		return
+	}
+
+	events, closed := session.wait(c, timeout)
+	if closed {
+		hub.removePollSession(session)
+	} else {
+		hub.finishPoll(session)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"session": session.id,
+		"events":  events,
+		"closed":  closed, // 会话已被服务器关闭，下次轮询不带session参数重新创建
+	})
+}
+
+// startPoll 查找或创建长轮询会话并标记为轮询中，会话不存在或不属于该用户时创建新会话
+func (h *Hub) startPoll(c *gin.Context, sessionID, userID string) (*pollSession, bool) {
+	h.polls.mu.Lock()
+	defer h.polls.mu.Unlock()
+
+	if session, ok := h.polls.sessions[sessionID]; ok && session.client.UserID == userID {
+		if session.polling {
+			return nil, false
+		}
+		session.idle.Stop()
+		session.polling = true
+		session.client.touch()
+		return session, true
+	}
+
+	session := &pollSession{id: uuid.NewString(), client: h.newClient(c, userID, TransportLongPoll), polling: true}
+	session.idle = time.AfterFunc(pollSessionIdle, func() { h.expirePollSession(session) })
+	session.idle.Stop()
+	h.polls.sessions[session.id] = session
+	// Hub已关闭时通道会被关闭，本次轮询立即返回closed
+	if !h.registerClient(session.client) {
+		close(session.client.Send)
+	}
+	return session, true
+}
+
+// pollSessionOwner 返回长轮询会话所属的用户ID，会话不存在时返回空
+func (h *Hub) pollSessionOwner(sessionID string) string {
+	h.polls.mu.Lock()
+	defer h.polls.mu.Unlock()
+
+	if session, ok := h.polls.sessions[sessionID]; ok {
+		return session.client.UserID
+	}
+	return ""
+}
+
+// finishPoll 轮询请求结束，开始计算空闲时间
+func (h *Hub) finishPoll(session *pollSession) {
+	h.polls.mu.Lock()
+	defer h.polls.mu.Unlock()
+
+	session.polling = false
+	session.idle.Reset(pollSessionIdle)
+}
+
+// expirePollSession 客户端长时间没有轮询，注销会话
+func (h *Hub) expirePollSession(session *pollSession) {
+	h.polls.mu.Lock()
+	if session.polling {
+		h.polls.mu.Unlock()
+		return
+	}
+	delete(h.polls.sessions, session.id)
+	h.polls.mu.Unlock()
+
+	h.unregisterClient(session.client)
+}
+
+// removePollSession 移除已被Hub关闭的会话
+func (h *Hub) removePollSession(session *pollSession) {
+	h.polls.mu.Lock()
+	defer h.polls.mu.Unlock()
+
+	session.idle.Stop()
+	delete(h.polls.sessions, session.id)
+}
+
+// wait 等待第一个事件或超时，然后取出缓冲区中所有事件。
+// 第二个返回值表示发送通道已被Hub关闭
+func (s *pollSession) wait(c *gin.Context, timeout time.Duration) ([]json.RawMessage, bool) {
+	events := []json.RawMessage{}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case message, ok := <-s.client.Send:
+		if !ok {
+			return events, true
+		}
+		events = append(events, message.JSON())
+	case <-timer.C:
+		return events, false
+	case <-c.Request.Context().Done():
+		return events, false
+	}
+
+	for {
+		select {
+		case message, ok := <-s.client.Send:
+			if !ok {
+				return events, true
+			}
+			events = append(events, message.JSON())
+		default:
+			// 缓冲区清空后重放溢出的事件
+			s.client.drained()
+			return events, false
+		}
+	}
+}
@@ -3,27 +3,72 @@ package websocket
 import (
 	"log"
 	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/yourusername/gin-vue-chat/config"
 )
 
 // Client 是一个中间人，在websocket连接和hub之间
 type Client struct {
-	Hub  *Hub
+	// 连接ID，用于管理接口定位连接
+	ID  string
+	Hub *Hub
+	// WebSocket连接，其他传输方式为nil
 	Conn *Connection
+	// 传输方式
+	Transport string
 	// 用户ID
 	UserID string
 	// 发送消息的通道
-	Send chan []byte
+	Send chan *Frame
+	// 帧编码格式，由协商的子协议决定
+	format string
+	// 订阅的房间，由hub的锁保护
+	rooms map[string]bool
+	// 因缓冲区满丢弃的帧数
+	dropped uint64
+	// 有消息溢出到待确认存储，缓冲区清空后需要重放
+	spilled bool
+	// 已因缓冲区满被断开，等待注销
+	closing bool
+	// 新连接正在重放待确认事件，期间的实时消息暂存在held中，重放完成后再发送
+	replaying bool
+	held      []*Frame
+	// 按键记录的上次允许时间，用于限制临时事件的频率
+	limits map[string]time.Time
+	// 被管理员强制断开
+	kicked bool
+	// 连接建立时间和客户端信息
+	ConnectedAt time.Time
+	RemoteAddr  string
+	UserAgent   string
+	// 最近一次收到pong的时间（UnixNano），SSE和长轮询记录最近一次心跳或轮询
+	lastPong int64
 	// 互斥锁，保护连接
 	mu sync.Mutex
 }
 
 // Hub 维护活跃客户端的集合并广播消息
 type Hub struct {
+	// 实例ID，用于识别跨实例消息的来源
+	id string
+
+	// 跨实例消息转发，为nil时只投递给本实例的连接
+	broker Broker
+
 	// 注册的客户端
 	clients map[*Client]bool
 
-	// 用户ID到客户端的映射
-	userClients map[string]*Client
+	// 用户ID到客户端集合的映射，同一用户可以同时有多个连接
+	userClients map[string]map[*Client]bool
+
+	// 房间到订阅连接的映射，例如群组
+	rooms map[string]map[*Client]bool
+
+	// 连接建立时加载房间的函数
+	roomLoader RoomLoader
 
 	// 从客户端入站的消息
 	broadcast chan []byte
@@ -34,76 +79,239 @@ type Hub struct {
 	// 注销请求
 	unregister chan *Client
 
+	// 入站消息处理器，按消息类型索引
+	handlers map[string]HandlerFunc
+
+	// 待确认事件存储
+	pending PendingStore
+
+	// 在线状态变化回调
+	onPresence PresenceFunc
+
+	// 按用户串行执行的在线状态回调
+	presence presenceQueues
+
+	// 最后一个连接断开后等待重连的计时器，按用户ID索引
+	offlineTimers map[string]*time.Timer
+
+	// 重连宽限期结束的用户
+	offline chan string
+
+	// 重连宽限期
+	presenceGrace time.Duration
+
+	// 慢消费者策略
+	policy string
+
+	// 客户端发送缓冲区大小
+	sendBufferSize int
+
+	// 慢消费者计数
+	counters hubCounters
+
+	// WebSocket升级器
+	upgrader websocket.Upgrader
+
+	// WebSocket连接参数
+	connOptions connOptions
+
+	// 认证消息的校验函数
+	authenticator Authenticator
+
+	// 长轮询会话
+	polls pollSessions
+
+	// 关闭后不再接受新连接，Run循环退出
+	done chan struct{}
+
+	// 正在运行的写协程，关闭时等待它们发送完缓冲区
+	writers sync.WaitGroup
+
 	// 互斥锁，保护maps
 	mu sync.RWMutex
 }
 
 // NewHub 创建一个新的Hub
 func NewHub() *Hub {
-	return &Hub{
+	id := config.AppConfig.Server.InstanceID
+	if id == "" {
+		id = uuid.NewString()
+	}
+
+	h := &Hub{
+		id:          id,
 		broadcast:   make(chan []byte),
 		register:    make(chan *Client),
 		unregister:  make(chan *Client),
 		clients:     make(map[*Client]bool),
-		userClients: make(map[string]*Client),
+		userClients: make(map[string]map[*Client]bool),
+		rooms:       make(map[string]map[*Client]bool),
+		handlers:    make(map[string]HandlerFunc),
 		mu:          sync.RWMutex{},
+
+		offlineTimers: make(map[string]*time.Timer),
+		offline:       make(chan string),
+		presenceGrace: config.AppConfig.WebSocket.PresenceGrace,
+		presence:      presenceQueues{pending: make(map[string][]presenceUpdate)},
+		pending:       NewMemoryPendingStore(),
+
+		policy:         slowConsumerPolicy(),
+		sendBufferSize: sendBufferSize(),
+		upgrader:       newUpgrader(),
+		connOptions:    newConnOptions(),
+		polls:          pollSessions{sessions: make(map[string]*pollSession)},
+		done:           make(chan struct{}),
 	}
+	h.Handle(FrameEventAck, h.handleEventAck)
+	return h
 }
 
 // Run 启动hub的消息处理循环
 func (h *Hub) Run() {
+	if h.broker != nil {
+		if err := h.broker.Subscribe(h.handleBrokerMessage); err != nil {
+			log.Printf("订阅跨实例消息失败: %v", err)
+		}
+	}
+
 	for {
 		select {
+		case <-h.done:
+			return
+
 		case client := <-h.register:
 			h.mu.Lock()
+			// 关闭过程中到达的注册请求直接拒绝
+			if h.Closed() {
+				close(client.Send)
+				h.mu.Unlock()
+				continue
+			}
 			h.clients[client] = true
+			if client.rooms == nil {
+				client.rooms = make(map[string]bool)
+			}
 			if client.UserID != "" {
-				h.userClients[client.UserID] = client
-				log.Printf("Client registered: %s", client.UserID)
+				if h.userClients[client.UserID] == nil {
+					h.userClients[client.UserID] = make(map[*Client]bool)
+				}
+				h.userClients[client.UserID][client] = true
+				if len(h.userClients[client.UserID]) == 1 {
+					h.userConnected(client.UserID)
+				}
+				log.Printf("Client registered: %s (%d sessions)", client.UserID, len(h.userClients[client.UserID]))
+				client.mu.Lock()
+				client.replaying = true
+				client.mu.Unlock()
+				go h.replayOnConnect(client)
 			}
 			h.mu.Unlock()
 
 		case client := <-h.unregister:
 			h.mu.Lock()
 			if _, ok := h.clients[client]; ok {
-				delete(h.clients, client)
-				if client.UserID != "" {
-					delete(h.userClients, client.UserID)
-					log.Printf("Client unregistered: %s", client.UserID)
-				}
-				close(client.Send)
+				h.removeClient(client)
+				log.Printf("Client unregistered: %s", client.UserID)
 			}
 			h.mu.Unlock()
 
 		case message := <-h.broadcast:
-			h.mu.RLock()
+			frame := newFrame(message)
+			h.mu.Lock()
 			for client := range h.clients {
-				select {
-				case client.Send <- message:
-				default:
-					h.mu.RUnlock()
-					h.mu.Lock()
-					delete(h.clients, client)
-					if client.UserID != "" {
-						delete(h.userClients, client.UserID)
-					}
-					close(client.Send)
-					h.mu.Unlock()
-					h.mu.RLock()
+				h.enqueue(client, frame)
+			}
+			h.mu.Unlock()
+
+		case userID := <-h.offline:
+			h.mu.Lock()
+			h.userOffline(userID)
+			h.mu.Unlock()
+		}
+	}
+}
+
+// removeClient 移除客户端并关闭其发送通道，调用方必须持有写锁
+func (h *Hub) removeClient(client *Client) {
+	delete(h.clients, client)
+	for room := range client.rooms {
+		h.unsubscribe(client, room)
+	}
+	if client.UserID != "" {
+		// 只移除当前连接，保留该用户的其他会话
+		if sessions, ok := h.userClients[client.UserID]; ok {
+			delete(sessions, client)
+			if len(sessions) == 0 {
+				delete(h.userClients, client.UserID)
+				// 关闭时由Shutdown统一处理离线
+				if !h.Closed() {
+					h.userDisconnected(client.UserID)
 				}
 			}
-			h.mu.RUnlock()
 		}
 	}
+	close(client.Send)
 }
 
-// SendToUser 发送消息给特定用户
+// SendToUser 发送消息给特定用户在所有实例上的连接，
+// 返回值只表示本实例是否至少有一个连接收到
 func (h *Hub) SendToUser(userID string, message []byte) bool {
+	delivered := h.sendToLocalUser(userID, newFrame(message))
+	h.publish(&BrokerMessage{Kind: brokerKindUser, UserID: userID, Data: message})
+	return delivered
+}
+
+// sendToLocalUser 发送消息给特定用户在本实例上的所有连接
+func (h *Hub) sendToLocalUser(userID string, message *Frame) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	delivered := false
+	for client := range h.userClients[userID] {
+		if h.enqueue(client, message) {
+			delivered = true
+		}
+	}
+
+	return delivered
+}
+
+// sendToLocalUsers 发送同一帧给一组用户在本实例上的所有连接
+func (h *Hub) sendToLocalUsers(userIDs []string, message *Frame) {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
 
-	client, exists := h.userClients[userID]
-	if !exists {
+	for _, userID := range userIDs {
+		for client := range h.userClients[userID] {
+			h.enqueue(client, message)
+		}
+	}
+}
+
+// Handle 注册某一类型入站消息的处理器，必须在Run之前调用
+func (h *Hub) Handle(msgType string, handler HandlerFunc) {
+	h.handlers[msgType] = handler
+}
+
+// sendToClient 发送消息给指定的客户端连接，缓冲区已满时按慢消费者策略处理
+func (h *Hub) sendToClient(client *Client, message *Frame) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	// 客户端已注销时通道已关闭，不能再写入
+	if _, ok := h.clients[client]; !ok {
+		return false
+	}
+
+	return h.enqueue(client, message)
+}
+
+// trySendToClient 尝试发送消息给指定的客户端连接，缓冲区已满时直接返回false
+func (h *Hub) trySendToClient(client *Client, message *Frame) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if _, ok := h.clients[client]; !ok {
 		return false
 	}
 
@@ -121,4 +329,46 @@ func (h *Hub) SendToUser(userID string, message []byte) bool {
 // Broadcast 广播消息给所有连接的客户端
 func (h *Hub) Broadcast(message []byte) {
 	h.broadcast <- message
+	h.publish(&BrokerMessage{Kind: brokerKindBroadcast, Data: message})
+}
+
+// SetBroker 设置跨实例消息转发，必须在Run之前调用
+func (h *Hub) SetBroker(broker Broker) {
+	h.broker = broker
+}
+
+// publish 发布消息给其他实例
+func (h *Hub) publish(msg *BrokerMessage) {
+	if h.broker == nil {
+		return
+	}
+
+	msg.Origin = h.id
+	if err := h.broker.Publish(msg); err != nil {
+		log.Printf("发布跨实例消息失败: %v", err)
+	}
+}
+
+// handleBrokerMessage 投递其他实例发布的消息给本实例的连接
+func (h *Hub) handleBrokerMessage(msg *BrokerMessage) {
+	if msg.Origin == h.id {
+		return
+	}
+
+	switch msg.Kind {
+	case brokerKindUser:
+		h.sendToLocalUser(msg.UserID, newFrame(msg.Data))
+	case brokerKindUsers:
+		h.sendToLocalUsers(msg.Users, &Frame{data: msg.Data, priority: msg.Priority})
+	case brokerKindBroadcast:
+		h.broadcast <- msg.Data
+	case brokerKindRoom:
+		h.sendToLocalRoom(msg.Room, newFrame(msg.Data), msg.Except)
+	case brokerKindJoin:
+		h.joinLocalRoom(msg.UserID, msg.Room)
+	case brokerKindLeave:
+		h.leaveLocalRoom(msg.UserID, msg.Room)
+	case brokerKindKick:
+		h.kickLocal(msg.UserID, msg.Client)
+	}
 }
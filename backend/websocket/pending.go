@@ -0,0 +1,382 @@
+package websocket
+
+import (
+	"context"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// 待确认事件的保留时间
+	pendingTTL = 7 * 24 * time.Hour
+
+	// 内存存储中每个用户或房间最多保留的待确认事件数
+	maxMemoryPending = 1000
+
+	// 每次连接最多重放的房间事件数，其余的在确认后下次连接时重放
+	maxRoomReplay = 1000
+)
+
+// PendingEvent 等待客户端确认的事件。推送给用户的事件每个接收者一条记录，
+// 共用同一个事件ID，各自确认各自的记录；房间事件只保存一条，成员按各自的确认位置重放
+type PendingEvent struct {
+	ID        string    `bson:"eventId"`
+	UserID    string    `bson:"userId,omitempty"`
+	Room      string    `bson:"room,omitempty"`
+	Except    string    `bson:"except,omitempty"` // 房间事件跳过的用户ID，例如消息的发送者
+	Ref       string    `bson:"ref,omitempty"`    // 事件关联的对象ID，例如消息ID
+	Data      []byte    `bson:"data"`
+	CreatedAt time.Time `bson:"createdAt"`
+}
+
+// PendingStore 保存已发出但尚未被客户端确认的事件
+type PendingStore interface {
+	// Push 保存一个待确认事件
+	Push(event *PendingEvent) error
+	// PushMany 批量保存待确认事件，用于推送给多个用户的事件
+	PushMany(events []*PendingEvent) error
+	// List 按发送顺序返回用户所有待确认事件
+	List(userID string) ([]*PendingEvent, error)
+	// Ack 删除用户已确认的事件
+	Ack(userID string, ids []string) error
+	// DropRef 删除所有用户和房间关联某个对象的待确认事件
+	DropRef(ref string) error
+	// PushRoom 保存一个房间事件，房间的所有成员共用
+	PushRoom(event *PendingEvent) error
+	// ListRooms 按发送顺序返回各房间中确认位置之后的事件
+	ListRooms(cursors map[string]string) ([]*PendingEvent, error)
+	// RoomCursors 返回用户在各房间中已确认到的事件ID，没有记录的房间不在结果中
+	RoomCursors(userID string, rooms []string) (map[string]string, error)
+	// AckRoom 将用户在各房间中的确认位置推进到指定事件，只会向后移动
+	AckRoom(userID string, cursors map[string]string) error
+}
+
+// MemoryPendingStore 基于内存的待确认事件存储，仅适用于单实例部署
+type MemoryPendingStore struct {
+	mu      sync.Mutex
+	events  map[string][]*PendingEvent
+	rooms   map[string][]*PendingEvent
+	cursors map[string]map[string]string // 用户在各房间中的确认位置
+}
+
+// NewMemoryPendingStore 创建内存存储
+func NewMemoryPendingStore() *MemoryPendingStore {
+	return &MemoryPendingStore{
+		events:  make(map[string][]*PendingEvent),
+		rooms:   make(map[string][]*PendingEvent),
+		cursors: make(map[string]map[string]string),
+	}
+}
+
+// Push 保存一个待确认事件，超出上限时丢弃最早的事件
+func (s *MemoryPendingStore) Push(event *PendingEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	events := append(s.events[event.UserID], event)
+	if len(events) > maxMemoryPending {
+		events = events[len(events)-maxMemoryPending:]
+	}
+	s.events[event.UserID] = events
+	return nil
+}
+
+// PushMany 批量保存待确认事件
+func (s *MemoryPendingStore) PushMany(events []*PendingEvent) error {
+	for _, event := range events {
+		if err := s.Push(event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// List 按发送顺序返回用户所有待确认事件
+func (s *MemoryPendingStore) List(userID string) ([]*PendingEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	events := make([]*PendingEvent, len(s.events[userID]))
+	copy(events, s.events[userID])
+	return events, nil
+}
+
+// Ack 删除用户已确认的事件
+func (s *MemoryPendingStore) Ack(userID string, ids []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	acked := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		acked[id] = true
+	}
+
+	remaining := s.events[userID][:0]
+	for _, event := range s.events[userID] {
+		if !acked[event.ID] {
+			remaining = append(remaining, event)
+		}
+	}
+
+	if len(remaining) == 0 {
+		delete(s.events, userID)
+	} else {
+		s.events[userID] = remaining
+	}
+	return nil
+}
+
+// DropRef 删除所有用户和房间关联某个对象的待确认事件
+func (s *MemoryPendingStore) DropRef(ref string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, byKey := range []map[string][]*PendingEvent{s.events, s.rooms} {
+		for key, events := range byKey {
+			remaining := events[:0]
+			for _, event := range events {
+				if event.Ref != ref {
+					remaining = append(remaining, event)
+				}
+			}
+			byKey[key] = remaining
+		}
+	}
+	return nil
+}
+
+// PushRoom 保存一个房间事件，超出上限时丢弃最早的事件
+func (s *MemoryPendingStore) PushRoom(event *PendingEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	events := append(s.rooms[event.Room], event)
+	if len(events) > maxMemoryPending {
+		events = events[len(events)-maxMemoryPending:]
+	}
+	s.rooms[event.Room] = events
+	return nil
+}
+
+// ListRooms 按发送顺序返回各房间中确认位置之后的事件
+func (s *MemoryPendingStore) ListRooms(cursors map[string]string) ([]*PendingEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var events []*PendingEvent
+	for room, after := range cursors {
+		for _, event := range s.rooms[room] {
+			if event.ID > after {
+				events = append(events, event)
+			}
+		}
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].ID < events[j].ID })
+	if len(events) > maxRoomReplay {
+		events = events[:maxRoomReplay]
+	}
+	return events, nil
+}
+
+// RoomCursors 返回用户在各房间中已确认到的事件ID
+func (s *MemoryPendingStore) RoomCursors(userID string, rooms []string) (map[string]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cursors := make(map[string]string, len(rooms))
+	for _, room := range rooms {
+		if id, ok := s.cursors[userID][room]; ok {
+			cursors[room] = id
+		}
+	}
+	return cursors, nil
+}
+
+// AckRoom 将用户在各房间中的确认位置推进到指定事件
+func (s *MemoryPendingStore) AckRoom(userID string, cursors map[string]string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cursors[userID] == nil {
+		s.cursors[userID] = make(map[string]string)
+	}
+	for room, id := range cursors {
+		if id > s.cursors[userID][room] {
+			s.cursors[userID][room] = id
+		}
+	}
+	return nil
+}
+
+// MongoPendingStore 基于MongoDB的待确认事件存储
+type MongoPendingStore struct {
+	collection *mongo.Collection
+	// 用户在各房间中的确认位置
+	cursors *mongo.Collection
+}
+
+// NewMongoPendingStore 创建MongoDB存储，并建立查询索引和过期索引。
+// 确认位置超过保留时间没有更新时删除，对应的房间事件也已过期
+func NewMongoPendingStore(collection, cursors *mongo.Collection) *MongoPendingStore {
+	_, err := collection.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "userId", Value: 1}, {Key: "eventId", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{
+			Keys:    bson.D{{Key: "room", Value: 1}, {Key: "eventId", Value: 1}},
+			Options: options.Index().SetPartialFilterExpression(bson.M{"room": bson.M{"$exists": true}}),
+		},
+		{Keys: bson.D{{Key: "ref", Value: 1}}, Options: options.Index().SetSparse(true)},
+		{Keys: bson.D{{Key: "createdAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(int32(pendingTTL.Seconds()))},
+	})
+	if err != nil {
+		log.Printf("创建待确认事件索引失败: %v", err)
+	}
+
+	_, err = cursors.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "userId", Value: 1}, {Key: "room", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "updatedAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(int32(pendingTTL.Seconds()))},
+	})
+	if err != nil {
+		log.Printf("创建房间确认位置索引失败: %v", err)
+	}
+
+	return &MongoPendingStore{collection: collection, cursors: cursors}
+}
+
+// Push 保存一个待确认事件
+func (s *MongoPendingStore) Push(event *PendingEvent) error {
+	_, err := s.collection.InsertOne(context.Background(), event)
+	return err
+}
+
+// PushMany 批量保存待确认事件
+func (s *MongoPendingStore) PushMany(events []*PendingEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	records := make([]interface{}, 0, len(events))
+	for _, event := range events {
+		records = append(records, event)
+	}
+	_, err := s.collection.InsertMany(context.Background(), records, options.InsertMany().SetOrdered(false))
+	return err
+}
+
+// List 按发送顺序返回用户所有待确认事件，事件ID是单调递增的ObjectID
+func (s *MongoPendingStore) List(userID string) ([]*PendingEvent, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "eventId", Value: 1}})
+	cursor, err := s.collection.Find(context.Background(), bson.M{"userId": userID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	events := []*PendingEvent{}
+	if err = cursor.All(context.Background(), &events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// Ack 删除用户已确认的事件
+func (s *MongoPendingStore) Ack(userID string, ids []string) error {
+	_, err := s.collection.DeleteMany(context.Background(), bson.M{
+		"userId":  userID,
+		"eventId": bson.M{"$in": ids},
+	})
+	return err
+}
+
+// DropRef 删除所有用户和房间关联某个对象的待确认事件
+func (s *MongoPendingStore) DropRef(ref string) error {
+	_, err := s.collection.DeleteMany(context.Background(), bson.M{"ref": ref})
+	return err
+}
+
+// PushRoom 保存一个房间事件
+func (s *MongoPendingStore) PushRoom(event *PendingEvent) error {
+	_, err := s.collection.InsertOne(context.Background(), event)
+	return err
+}
+
+// ListRooms 按发送顺序返回各房间中确认位置之后的事件
+func (s *MongoPendingStore) ListRooms(cursors map[string]string) ([]*PendingEvent, error) {
+	if len(cursors) == 0 {
+		return []*PendingEvent{}, nil
+	}
+
+	conditions := make([]bson.M, 0, len(cursors))
+	for room, after := range cursors {
+		conditions = append(conditions, bson.M{"room": room, "eventId": bson.M{"$gt": after}})
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "eventId", Value: 1}}).SetLimit(maxRoomReplay)
+	cursor, err := s.collection.Find(context.Background(), bson.M{"$or": conditions}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	events := []*PendingEvent{}
+	if err = cursor.All(context.Background(), &events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// roomCursor MongoDB中用户在房间中的确认位置
+type roomCursor struct {
+	UserID    string    `bson:"userId"`
+	Room      string    `bson:"room"`
+	EventID   string    `bson:"eventId"`
+	UpdatedAt time.Time `bson:"updatedAt"`
+}
+
+// RoomCursors 返回用户在各房间中已确认到的事件ID
+func (s *MongoPendingStore) RoomCursors(userID string, rooms []string) (map[string]string, error) {
+	cursors := make(map[string]string, len(rooms))
+	if len(rooms) == 0 {
+		return cursors, nil
+	}
+
+	cursor, err := s.cursors.Find(context.Background(), bson.M{"userId": userID, "room": bson.M{"$in": rooms}})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	var records []*roomCursor
+	if err = cursor.All(context.Background(), &records); err != nil {
+		return nil, err
+	}
+	for _, record := range records {
+		cursors[record.Room] = record.EventID
+	}
+	return cursors, nil
+}
+
+// AckRoom 将用户在各房间中的确认位置推进到指定事件，事件ID是单调递增的ObjectID，按字符串比较即可
+func (s *MongoPendingStore) AckRoom(userID string, cursors map[string]string) error {
+	if len(cursors) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	models := make([]mongo.WriteModel, 0, len(cursors))
+	for room, id := range cursors {
+		models = append(models, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"userId": userID, "room": room}).
+			SetUpdate(bson.M{
+				"$max": bson.M{"eventId": id},
+				"$set": bson.M{"updatedAt": now},
+			}).
+			SetUpsert(true))
+	}
+	_, err := s.cursors.BulkWrite(context.Background(), models, options.BulkWrite().SetOrdered(false))
+	return err
+}
@@ -0,0 +1,129 @@
+package websocket
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// 默认的重连宽限期
+const defaultPresenceGrace = 10 * time.Second
+
+// PresenceFunc 用户上线或下线时的回调，at为状态变化的时间，可用于丢弃过期的写入
+type PresenceFunc func(userID string, online bool, at time.Time)
+
+// presenceUpdate 等待执行的在线状态回调
+type presenceUpdate struct {
+	online bool
+	at     time.Time
+}
+
+// presenceQueues 按用户排队的在线状态回调，每个用户同时只有一个协程在执行
+type presenceQueues struct {
+	mu      sync.Mutex
+	pending map[string][]presenceUpdate
+	// 正在运行的回调协程，关闭时等待它们完成
+	running sync.WaitGroup
+}
+
+// OnPresence 设置在线状态变化回调，必须在Run之前调用
+func (h *Hub) OnPresence(fn PresenceFunc) {
+	h.onPresence = fn
+}
+
+// userConnected 用户的第一个连接建立，调用方必须持有写锁
+func (h *Hub) userConnected(userID string) {
+	// 宽限期内重连，用户一直处于在线状态
+	if timer, ok := h.offlineTimers[userID]; ok {
+		timer.Stop()
+		delete(h.offlineTimers, userID)
+		return
+	}
+
+	h.notifyPresence(userID, true, time.Now())
+}
+
+// userDisconnected 用户的最后一个连接断开，等待宽限期后再标记为离线，调用方必须持有写锁
+func (h *Hub) userDisconnected(userID string) {
+	grace := h.presenceGrace
+	if grace <= 0 {
+		grace = defaultPresenceGrace
+	}
+
+	// Hub关闭后Run不再接收，计时器的回调不能一直阻塞。
+	// 关闭时仍在offlineTimers中的用户由Shutdown标记为离线
+	h.offlineTimers[userID] = time.AfterFunc(grace, func() {
+		select {
+		case h.offline <- userID:
+		case <-h.done:
+		}
+	})
+}
+
+// userOffline 宽限期结束，调用方必须持有写锁
+func (h *Hub) userOffline(userID string) {
+	// 计时器已被重连取消
+	if _, ok := h.offlineTimers[userID]; !ok {
+		return
+	}
+	delete(h.offlineTimers, userID)
+
+	if len(h.userClients[userID]) > 0 {
+		return
+	}
+
+	h.notifyPresence(userID, false, time.Now())
+}
+
+// notifyPresence 异步调用在线状态回调，避免阻塞hub。
+// 同一用户的回调按状态变化的顺序串行执行，快速断开重连时写入不会乱序
+func (h *Hub) notifyPresence(userID string, online bool, at time.Time) {
+	if h.onPresence == nil {
+		return
+	}
+
+	h.presence.mu.Lock()
+	defer h.presence.mu.Unlock()
+
+	queue, running := h.presence.pending[userID]
+	h.presence.pending[userID] = append(queue, presenceUpdate{online: online, at: at})
+	if !running {
+		h.presence.running.Add(1)
+		go h.runPresence(userID)
+	}
+}
+
+// runPresence 依次执行用户排队的在线状态回调，队列为空时退出
+func (h *Hub) runPresence(userID string) {
+	defer h.presence.running.Done()
+
+	for {
+		h.presence.mu.Lock()
+		queue := h.presence.pending[userID]
+		if len(queue) == 0 {
+			delete(h.presence.pending, userID)
+			h.presence.mu.Unlock()
+			return
+		}
+		h.presence.pending[userID] = queue[1:]
+		h.presence.mu.Unlock()
+
+		h.onPresence(userID, queue[0].online, queue[0].at)
+	}
+}
+
+// waitPresence 等待所有排队的在线状态回调执行完毕，超过ctx的截止时间时返回ctx的错误
+func (h *Hub) waitPresence(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		h.presence.running.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
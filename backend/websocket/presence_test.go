@@ -0,0 +1,50 @@
+package websocket
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPresenceSerializedPerUser(t *testing.T) {
+	hub := NewHub()
+
+	var mu sync.Mutex
+	var got []bool
+	hub.OnPresence(func(userID string, online bool, at time.Time) {
+		mu.Lock()
+		first := len(got) == 0
+		mu.Unlock()
+
+		// 第一个回调更慢，未串行执行时记录顺序会颠倒
+		if first {
+			time.Sleep(50 * time.Millisecond)
+		}
+		mu.Lock()
+		got = append(got, online)
+		mu.Unlock()
+	})
+
+	for _, online := range []bool{true, false, true} {
+		hub.notifyPresence("alice", online, time.Now())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := hub.waitPresence(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := []bool{true, false, true}
+	if len(got) != len(want) {
+		t.Fatalf("回调 %v，期望 %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("回调顺序 %v，期望 %v", got, want)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package websocket
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+)
+
+// ProtocolVersion 当前WebSocket协议版本
+const ProtocolVersion = 1
+
+// 服务器回复的帧类型
+const (
+	FrameAck   = "ack"   // 请求处理成功
+	FrameError = "error" // 请求处理失败
+)
+
+// Envelope WebSocket消息信封
+type Envelope struct {
+	// 协议版本
+	V int `json:"v"`
+	// 消息类型
+	Type string `json:"type"`
+	// 请求ID，回复帧会带上相同的ID
+	ID string `json:"id,omitempty"`
+	// 消息内容
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// Error 返回给客户端的错误
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"error"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// NewError 创建一个返回给客户端的错误
+func NewError(code int, message string) *Error {
+	return &Error{Code: code, Message: message}
+}
+
+// HandlerFunc 处理某一类型的入站消息，返回值作为ack帧的payload
+type HandlerFunc func(c *Client, payload json.RawMessage) (interface{}, error)
+
+// handleMessage 解析入站消息并分发给对应的处理器
+func (c *Client) handleMessage(data []byte) {
+	var env Envelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		c.reply("", FrameError, NewError(http.StatusBadRequest, "消息格式无效"))
+		return
+	}
+
+	if env.V != ProtocolVersion {
+		c.reply(env.ID, FrameError, NewError(http.StatusBadRequest, "不支持的协议版本"))
+		return
+	}
+
+	handler, ok := c.Hub.handlers[env.Type]
+	if !ok {
+		c.reply(env.ID, FrameError, NewError(http.StatusBadRequest, "未知的消息类型: "+env.Type))
+		return
+	}
+
+	result, err := handler(c, env.Payload)
+	if err != nil {
+		var e *Error
+		if !errors.As(err, &e) {
+			log.Printf("处理消息失败 (%s): %v", env.Type, err)
+			e = NewError(http.StatusInternalServerError, "服务器错误")
+		}
+		c.reply(env.ID, FrameError, e)
+		return
+	}
+
+	c.reply(env.ID, FrameAck, result)
+}
+
+// reply 发送回复帧给客户端
+func (c *Client) reply(id, frameType string, payload interface{}) {
+	data, err := encodeReply(id, frameType, payload)
+	if err != nil {
+		log.Printf("回复序列化失败: %v", err)
+		return
+	}
+
+	if !c.Hub.sendToClient(c, newFrame(data)) {
+		log.Printf("回复发送失败: %s", c.UserID)
+	}
+}
+
+// encodeReply 编码回复帧
+func encodeReply(id, frameType string, payload interface{}) ([]byte, error) {
+	env := Envelope{V: ProtocolVersion, Type: frameType, ID: id}
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return nil, err
+		}
+		env.Payload = data
+	}
+
+	return json.Marshal(env)
+}
@@ -0,0 +1,21 @@
+package websocket
+
+import "time"
+
+// Allow 按键限制客户端的操作频率，距上次允许不足interval时返回false。
+// 用于输入状态等可以丢弃的临时事件
+func (c *Client) Allow(key string, interval time.Duration) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if last, ok := c.limits[key]; ok && now.Sub(last) < interval {
+		return false
+	}
+
+	if c.limits == nil {
+		c.limits = make(map[string]time.Time)
+	}
+	c.limits[key] = now
+	return true
+}
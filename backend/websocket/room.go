@@ -0,0 +1,124 @@
+package websocket
+
+import (
+	"log"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// RoomLoader 返回用户连接时需要订阅的房间，例如用户所在的群组
+type RoomLoader func(userID string) ([]string, error)
+
+// SetRoomLoader 设置连接建立时加载房间的函数，必须在Run之前调用
+func (h *Hub) SetRoomLoader(loader RoomLoader) {
+	h.roomLoader = loader
+}
+
+// loadRooms 为新连接订阅用户所在的房间
+func (h *Hub) loadRooms(client *Client) {
+	if h.roomLoader == nil {
+		return
+	}
+
+	rooms, err := h.roomLoader(client.UserID)
+	if err != nil {
+		log.Printf("加载房间失败 (%s): %v", client.UserID, err)
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	// 加载期间连接可能已经断开
+	if _, ok := h.clients[client]; !ok {
+		return
+	}
+	for _, room := range rooms {
+		h.subscribe(client, room)
+	}
+}
+
+// subscribe 将连接加入房间，调用方必须持有写锁
+func (h *Hub) subscribe(client *Client, room string) {
+	if h.rooms[room] == nil {
+		h.rooms[room] = make(map[*Client]bool)
+	}
+	h.rooms[room][client] = true
+	client.rooms[room] = true
+}
+
+// unsubscribe 将连接移出房间，调用方必须持有写锁
+func (h *Hub) unsubscribe(client *Client, room string) {
+	delete(client.rooms, room)
+	if members, ok := h.rooms[room]; ok {
+		delete(members, client)
+		if len(members) == 0 {
+			delete(h.rooms, room)
+		}
+	}
+}
+
+// JoinRoom 将用户在所有实例上的连接加入房间，用户之后建立的连接由RoomLoader加载。
+// 用户在房间中的确认位置移到现在，加入之前的房间事件不再重放
+func (h *Hub) JoinRoom(userID, room string) {
+	if err := h.pending.AckRoom(userID, map[string]string{room: primitive.NewObjectID().Hex()}); err != nil {
+		log.Printf("初始化房间确认位置失败 (%s): %v", userID, err)
+	}
+	h.joinLocalRoom(userID, room)
+	h.publish(&BrokerMessage{Kind: brokerKindJoin, UserID: userID, Room: room})
+}
+
+// LeaveRoom 将用户在所有实例上的连接移出房间
+func (h *Hub) LeaveRoom(userID, room string) {
+	h.leaveLocalRoom(userID, room)
+	h.publish(&BrokerMessage{Kind: brokerKindLeave, UserID: userID, Room: room})
+}
+
+// joinLocalRoom 将用户在本实例上的连接加入房间
+func (h *Hub) joinLocalRoom(userID, room string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for client := range h.userClients[userID] {
+		h.subscribe(client, room)
+	}
+}
+
+// leaveLocalRoom 将用户在本实例上的连接移出房间
+func (h *Hub) leaveLocalRoom(userID, room string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for client := range h.userClients[userID] {
+		h.unsubscribe(client, room)
+	}
+}
+
+// PublishToRoom 推送事件给房间内所有实例上的连接，事件只编码一次。
+// exceptUserID不为空时跳过该用户的连接，例如正在输入的用户。
+// 事件不进入待确认存储，只用于输入状态这类可丢失的临时事件，
+// 需要保证送达的房间事件使用DeliverToRoom
+func (h *Hub) PublishToRoom(room, eventType string, payload interface{}, exceptUserID string) error {
+	data, err := encodeEvent("", eventType, payload)
+	if err != nil {
+		return err
+	}
+
+	h.sendToLocalRoom(room, newFrame(data), exceptUserID)
+	h.publish(&BrokerMessage{Kind: brokerKindRoom, Room: room, Except: exceptUserID, Data: data})
+	return nil
+}
+
+// sendToLocalRoom 发送消息给房间内本实例上的连接
+func (h *Hub) sendToLocalRoom(room string, message *Frame, exceptUserID string) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for client := range h.rooms[room] {
+		if exceptUserID != "" && client.UserID == exceptUserID {
+			continue
+		}
+
+		h.enqueue(client, message)
+	}
+}
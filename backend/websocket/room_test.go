@@ -0,0 +1,99 @@
+package websocket
+
+import "testing"
+
+func TestRoomPublishCrossInstance(t *testing.T) {
+	broker := NewMemoryBroker()
+
+	hubA := NewHub()
+	hubA.SetBroker(broker)
+	go hubA.Run()
+
+	hubB := NewHub()
+	hubB.SetBroker(broker)
+	go hubB.Run()
+
+	alice := newTestClient(t, hubA, "alice")
+	bob := newTestClient(t, hubB, "bob")
+
+	// 房间成员变化和房间消息跨实例生效
+	hubA.JoinRoom("alice", "group1")
+	hubA.JoinRoom("bob", "group1")
+	if err := hubA.PublishToRoom("group1", "typing", "hi", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	expectMessage(t, bob, `{"v":1,"type":"typing","payload":"hi"}`)
+	expectNoMessage(t, alice)
+
+	hubB.LeaveRoom("bob", "group1")
+	if err := hubB.PublishToRoom("group1", "typing", "bye", ""); err != nil {
+		t.Fatal(err)
+	}
+	expectMessage(t, alice, `{"v":1,"type":"typing","payload":"bye"}`)
+	expectNoMessage(t, bob)
+}
+
+func TestDeliverToRoom(t *testing.T) {
+	broker := NewMemoryBroker()
+	// 多个实例共享同一个待确认存储
+	store := NewMemoryPendingStore()
+	loader := func(userID string) ([]string, error) { return []string{"group1"}, nil }
+
+	hubA := NewHub()
+	hubA.SetBroker(broker)
+	hubA.SetPendingStore(store)
+	hubA.SetRoomLoader(loader)
+	go hubA.Run()
+
+	hubB := NewHub()
+	hubB.SetBroker(broker)
+	hubB.SetPendingStore(store)
+	hubB.SetRoomLoader(loader)
+	go hubB.Run()
+
+	alice := newTestClient(t, hubA, "alice")
+	bob := newTestClient(t, hubB, "bob")
+
+	if err := hubA.DeliverToRoom("m1", "group1", "group", "first", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	expectEvent(t, bob, "group")
+	expectNoMessage(t, alice)
+
+	// 房间事件只保存一条，不为每个成员写入记录
+	if got := len(store.rooms["group1"]); got != 1 {
+		t.Fatalf("房间中有 %d 个事件，期望 1 个", got)
+	}
+	expectPending(t, store, "bob", 0)
+
+	// carol离线时加入房间，只重放加入之后的事件
+	hubA.JoinRoom("carol", "group1")
+	if err := hubB.DeliverToRoom("m2", "group1", "group", "second", ""); err != nil {
+		t.Fatal(err)
+	}
+	second := expectEvent(t, alice, "group")
+	if got := expectEvent(t, bob, "group"); got != second {
+		t.Fatalf("bob收到的事件ID %s 与alice的 %s 不同", got, second)
+	}
+
+	// 确认第二个事件同时确认了更早的事件
+	if err := hubB.AckEvents("bob", []string{second}); err != nil {
+		t.Fatal(err)
+	}
+
+	// alice没有确认，重连时跳过自己发送的事件
+	aliceAgain := newTestClient(t, hubB, "alice")
+	if got := expectEvent(t, aliceAgain, "group"); got != second {
+		t.Fatalf("alice重放了 %s，期望 %s", got, second)
+	}
+	expectNoMessage(t, aliceAgain)
+
+	carol := newTestClient(t, hubB, "carol")
+	if got := expectEvent(t, carol, "group"); got != second {
+		t.Fatalf("carol重放了 %s，期望 %s", got, second)
+	}
+	expectNoMessage(t, carol)
+
+	bobAgain := newTestClient(t, hubA, "bob")
+	expectNoMessage(t, bobAgain)
+}
@@ -0,0 +1,140 @@
+package websocket
+
+import (
+	"context"
+	"log"
+	"math/rand"
+	"time"
+)
+
+// FrameGoingAway 服务器关闭前发送给客户端的最后一个事件，提示客户端稍后重连
+const FrameGoingAway = "going_away"
+
+// 重连提示的延迟范围，随机分散避免所有客户端同时重连
+const (
+	minReconnectDelay = 1 * time.Second
+	maxReconnectDelay = 5 * time.Second
+)
+
+// registerClient 注册客户端，Hub已关闭时返回false
+func (h *Hub) registerClient(client *Client) bool {
+	select {
+	case h.register <- client:
+		return true
+	case <-h.done:
+		return false
+	}
+}
+
+// unregisterClient 注销客户端，Hub已关闭时直接返回
+func (h *Hub) unregisterClient(client *Client) {
+	select {
+	case h.unregister <- client:
+	case <-h.done:
+	}
+}
+
+// addWriter 登记一个写协程，Hub已关闭时返回false。
+// 持有读锁保证登记发生在Shutdown开始等待之前
+func (h *Hub) addWriter() bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if h.Closed() {
+		return false
+	}
+	h.writers.Add(1)
+	return true
+}
+
+// Closed 返回Hub是否已开始关闭，关闭后不再接受新连接
+func (h *Hub) Closed() bool {
+	select {
+	case <-h.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Done 返回Hub开始关闭时关闭的通道，用于停止依赖Hub的后台任务
+func (h *Hub) Done() <-chan struct{} {
+	return h.done
+}
+
+// Shutdown 停止接受新连接，向所有客户端发送重连提示后关闭发送通道，
+// 并等待写协程把缓冲区中的消息发送完毕，超过ctx的截止时间时返回ctx的错误
+func (h *Hub) Shutdown(ctx context.Context) error {
+	h.mu.Lock()
+	select {
+	case <-h.done:
+		h.mu.Unlock()
+		return nil
+	default:
+	}
+	close(h.done)
+
+	// 离线时间取断开连接之前，客户端之后重连到其他实例时写入的在线状态更新
+	offlineAt := time.Now()
+
+	// 停止重连宽限期计时器，服务器关闭后这些用户视为离线
+	offline := make([]string, 0, len(h.userClients)+len(h.offlineTimers))
+	for userID, timer := range h.offlineTimers {
+		timer.Stop()
+		delete(h.offlineTimers, userID)
+		offline = append(offline, userID)
+	}
+	for userID := range h.userClients {
+		offline = append(offline, userID)
+	}
+
+	for client := range h.clients {
+		delay := minReconnectDelay + time.Duration(rand.Int63n(int64(maxReconnectDelay-minReconnectDelay)))
+		notice, err := encodeEvent("", FrameGoingAway, map[string]int64{"reconnectAfter": delay.Milliseconds()})
+		if err == nil {
+			// 缓冲区已满时放弃提示，客户端收到关闭帧后同样会重连
+			select {
+			case client.Send <- newFrame(notice):
+			default:
+			}
+		}
+		h.removeClient(client)
+	}
+	h.mu.Unlock()
+
+	log.Printf("Hub正在关闭，等待 %d 个用户的连接发送完毕", len(offline))
+
+	// 等待写协程发送完缓冲区中的消息和关闭帧
+	drained := make(chan struct{})
+	go func() {
+		h.writers.Wait()
+		close(drained)
+	}()
+
+	var err error
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	// 等待在线状态回调执行完毕，确保在关闭数据库之前完成。已重连到其他实例的用户由回调跳过，
+	// 超过ctx的截止时间后不再等待
+	if h.onPresence != nil && ctx.Err() == nil {
+		for _, userID := range offline {
+			h.notifyPresence(userID, false, offlineAt)
+		}
+		if presenceErr := h.waitPresence(ctx); presenceErr != nil {
+			log.Printf("关闭超时，部分用户的在线状态未更新")
+			err = presenceErr
+		}
+	}
+
+	if h.broker != nil {
+		if closeErr := h.broker.Close(); closeErr != nil {
+			log.Printf("关闭跨实例消息连接失败: %v", closeErr)
+		}
+	}
+
+	return err
+}
@@ -53,7 +53,41 @@ export const messageApi = {
   // 获取群聊消息
   getGroupMessages: (groupId) => http.get(`/api/messages/group/${groupId}`),
   // 发送群聊消息
-  sendGroupMessage: (groupId, content) => http.post('/api/messages/group', { groupId, content })
+  sendGroupMessage: (groupId, content) => http.post('/api/messages/group', { groupId, content }),
+  // 编辑消息
+  editMessage: (messageId, content) => http.put(`/api/messages/${messageId}`, { content }),
+  // 获取消息编辑历史
+  getMessageRevisions: (messageId) => http.get(`/api/messages/${messageId}/revisions`),
+  // 撤回消息，群组管理员可删除群内任意消息
+  recallMessage: (messageId) => http.delete(`/api/messages/${messageId}`),
+  // 标记会话已读到某条消息
+  markRead: (type, targetId, messageId) => http.post('/api/messages/read', { type, targetId, messageId }),
+  // 获取消息的已读情况
+  getMessageReads: (messageId) => http.get(`/api/messages/${messageId}/reads`),
+  // 搜索消息
+  searchMessages: (params) => http.get('/api/messages/search', { params }),
+  // 获取@我的消息
+  getMentions: (params) => http.get('/api/mentions', { params }),
+  // 获取话题的根消息和回复
+  getThread: (messageId, params) => http.get(`/api/messages/${messageId}/thread`, { params }),
+  // 添加表情回应
+  addReaction: (messageId, emoji) => http.post(`/api/messages/${messageId}/reactions`, { emoji }),
+  // 取消表情回应
+  removeReaction: (messageId, emoji) => http.delete(`/api/messages/${messageId}/reactions/${encodeURIComponent(emoji)}`)
+}
+
+// 会话列表相关API
+export const conversationApi = {
+  // 获取会话列表
+  getConversations: () => http.get('/api/conversations'),
+  // 修改会话的免打扰和置顶设置
+  updateConversation: (type, targetId, settings) => http.put(`/api/conversations/${type}/${targetId}`, settings)
+}
+
+// WebSocket相关API
+export const wsApi = {
+  // 获取一次性连接票据
+  getTicket: () => http.post('/api/ws/ticket')
 }
 
 // 导出所有API
@@ -61,5 +95,7 @@ export default {
   user: userApi,
   friend: friendApi,
   group: groupApi,
-  message: messageApi
+  message: messageApi,
+  conversation: conversationApi,
+  ws: wsApi
 }
\ No newline at end of file
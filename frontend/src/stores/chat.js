@@ -1,6 +1,7 @@
 import { defineStore } from 'pinia'
 import { ref, computed } from 'vue'
 import { useUserStore } from './user'
+import { wsApi } from '../api'
 
 export const useChatStore = defineStore('chat', () => {
   // 引入用户store
@@ -12,6 +13,7 @@ export const useChatStore = defineStore('chat', () => {
   const activeChat = ref(null) // 当前活跃的聊天 {type: 'private'|'group', id: userId|groupId}
   const socket = ref(null)     // WebSocket连接
   const isConnected = ref(false) // WebSocket连接状态
+  let reconnectDelay = 3000      // 断开后重连的延迟，服务器关闭时会给出提示
   
   // 计算属性
   const currentChatMessages = computed(() => {
@@ -26,13 +28,28 @@ export const useChatStore = defineStore('chat', () => {
   
   // 方法
   // 初始化WebSocket连接
-  function initSocket() {
+  async function initSocket() {
     if (socket.value) {
       socket.value.close()
     }
     
+    // 获取一次性连接票据，避免令牌出现在URL中
+    let ticket
+    try {
+      const response = await wsApi.getTicket()
+      ticket = response.data.ticket
+    } catch (error) {
+      console.error('获取WebSocket票据失败:', error)
+      if (userStore.isLoggedIn) {
+        setTimeout(() => {
+          initSocket()
+        }, 3000)
+      }
+      return
+    }
+    
     // 创建WebSocket连接
-    const wsUrl = `${window.location.protocol === 'https:' ? 'wss:' : 'ws:'}//${window.location.host}/ws?token=${userStore.token}`
+    const wsUrl = `${window.location.protocol === 'https:' ? 'wss:' : 'ws:'}//${window.location.host}/ws?ticket=${ticket}`
     socket.value = new WebSocket(wsUrl)
     
     // 连接建立
@@ -44,23 +61,42 @@ export const useChatStore = defineStore('chat', () => {
     // 接收消息
     socket.value.onmessage = (event) => {
       try {
-        const data = JSON.parse(event.data)
-        handleIncomingMessage(data)
+        const frame = JSON.parse(event.data)
+        // 服务器对请求的回复帧
+        if (frame.type === 'ack' || frame.type === 'error') {
+          return
+        }
+        // 服务器即将关闭，按提示的延迟重连
+        if (frame.type === 'going_away') {
+          reconnectDelay = frame.payload.reconnectAfter
+          return
+        }
+        // 带ID的事件需要确认，否则重连时会被重放
+        if (frame.id) {
+          socket.value.send(JSON.stringify({ v: 1, type: 'event_ack', payload: { ids: [frame.id] } }))
+        }
+        handleIncomingMessage({ type: frame.type, ...frame.payload })
       } catch (error) {
         console.error('解析WebSocket消息失败:', error)
       }
     }
     
     // 连接关闭
-    socket.value.onclose = () => {
+    socket.value.onclose = (event) => {
       console.log('WebSocket连接已关闭')
       isConnected.value = false
       
+      // 被管理员强制断开时不自动重连
+      if (event.code === 1008) {
+        return
+      }
+      
       // 尝试重新连接
       if (userStore.isLoggedIn) {
         setTimeout(() => {
           initSocket()
-        }, 3000)
+        }, reconnectDelay)
+        reconnectDelay = 3000
       }
     }
     
@@ -71,6 +107,15 @@ export const useChatStore = defineStore('chat', () => {
     }
   }
   
+  // 查找编辑、撤回等事件对应的本地消息
+  function findLocalMessage(message) {
+    if (message.type === 'group') {
+      return (groupChats.value[message.groupId] || []).find(msg => msg.id === message.id)
+    }
+    const chatUserId = message.senderId === userStore.userId ? message.receiverId : message.senderId
+    return (privateChats.value[chatUserId] || []).find(msg => msg.id === message.id)
+  }
+  
   // 处理接收到的消息
   function handleIncomingMessage(data) {
     const { type, message } = data
@@ -85,9 +130,14 @@ export const useChatStore = defineStore('chat', () => {
         privateChats.value[chatUserId] = []
       }
       
+      // 重放的事件可能已经收到过
+      if (privateChats.value[chatUserId].some(msg => msg.id === message.id)) {
+        return
+      }
+      
       // 添加消息
       privateChats.value[chatUserId].push({
-        id: Date.now().toString(),
+        id: message.id,
         senderId: from,
         content,
         timestamp
@@ -96,6 +146,17 @@ export const useChatStore = defineStore('chat', () => {
       // 群聊消息
       const { groupId, senderId, content, timestamp } = message
       
+      // 话题回复不进入群聊消息列表，只更新根消息的回复数
+      if (message.threadId) {
+        const root = findLocalMessage({ type: 'group', groupId, id: message.threadId })
+        if (root) {
+          root.thread = root.thread || { replyCount: 0 }
+          root.thread.replyCount += 1
+          root.thread.lastReplyAt = timestamp
+        }
+        return
+      }
+      
       // 确保聊天记录数组存在
       if (!groupChats.value[groupId]) {
         groupChats.value[groupId] = []
@@ -118,13 +179,39 @@ export const useChatStore = defineStore('chat', () => {
         }
       }
       
+      // 重放的事件可能已经收到过
+      if (groupChats.value[groupId].some(msg => msg.id === message.id)) {
+        return
+      }
+      
       // 添加消息
       groupChats.value[groupId].push({
-        id: Date.now().toString(),
+        id: message.id,
         senderId,
         content,
         timestamp
       })
+    } else if (type === 'message_edited') {
+      // 消息被编辑，更新本地内容
+      const target = findLocalMessage(message)
+      if (target) {
+        target.content = message.content
+        target.editedAt = message.editedAt
+      }
+    } else if (type === 'message_recalled') {
+      // 消息被撤回，用撤回提示替换原内容
+      const target = findLocalMessage(message)
+      if (target) {
+        target.content = '消息已撤回'
+        target.recalledAt = message.recalledAt
+        target.reactions = []
+      }
+    } else if (type === 'message_reaction') {
+      // 表情回应变化，替换为最新的汇总
+      const target = findLocalMessage(message)
+      if (target) {
+        target.reactions = data.reactions
+      }
     }
   }
   